@@ -0,0 +1,148 @@
+package classify
+
+import (
+	"image"
+	"image/color"
+	"sort"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/montage"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+const (
+	// strongRatio is the min ratio of word stroke width to the body stroke
+	// width, both relative to the word height, for word to be strong.
+	strongRatio = 1.35
+
+	// minEmphasisSymbols is the min number of symbols in word to measure its
+	// stroke width. Shorter words don't have enough strokes to be reliable.
+	minEmphasisSymbols = 3
+
+	// minBodyWords is the min number of measured words in page to find the
+	// stroke width of body text.
+	minBodyWords = 20
+
+	// inkThreshold is the max luminance of ink pixel, or the min luminance
+	// if the image is dark, i.e. light text on dark background.
+	inkThreshold = 128
+)
+
+// Emphasis marks the words printed in bold as strong. Vision doesn't report
+// the font style, so it's inferred from the page image: the stroke width of
+// each word is measured from the horizontal runs of ink, then compared to the
+// body text. Italic is not detected, since the slant can't be measured from
+// the axis aligned boxes reliably. Headings are skipped, since they are
+// usually bold anyway.
+func Emphasis(page vision.Page, img image.Image) vision.Page {
+	// Find the ink polarity from the image itself, since it might differ
+	// from the montage that sent to Vision.
+	lightInk := montage.MeanLuminance(img) < inkThreshold
+
+	// Measure the stroke width of each word, relative to its height
+	type wordPos struct{ paragraph, line, word int }
+	var positions []wordPos
+	var strokes []float64
+	for pi, p := range page.Paragraphs {
+		switch p.Role {
+		case vision.RoleHeading, vision.RoleHeader, vision.RoleFooter, vision.RolePageNumber:
+			continue
+		}
+
+		for li, l := range p.Lines {
+			for wi, w := range l.Words {
+				if len(w.Symbols) < minEmphasisSymbols || w.BoundingBox.Dy() <= 0 {
+					continue
+				}
+
+				stroke, ok := strokeWidth(img, w.BoundingBox, lightInk)
+				if !ok {
+					continue
+				}
+
+				positions = append(positions, wordPos{pi, li, wi})
+				strokes = append(strokes, stroke/float64(w.BoundingBox.Dy()))
+			}
+		}
+	}
+
+	if len(strokes) < minBodyWords {
+		return page
+	}
+
+	sorted := append([]float64{}, strokes...)
+	sort.Float64s(sorted)
+	bodyStroke := sorted[len(sorted)/2]
+	if bodyStroke <= 0 {
+		return page
+	}
+
+	// Copy the paragraphs before marking the words, so the original page is
+	// not modified.
+	paragraphs := append([]vision.Paragraph{}, page.Paragraphs...)
+	copied := map[int]bool{}
+	for i, pos := range positions {
+		if strokes[i] < bodyStroke*strongRatio {
+			continue
+		}
+
+		if !copied[pos.paragraph] {
+			p := paragraphs[pos.paragraph]
+			p.Lines = append([]vision.Line{}, p.Lines...)
+			for li := range p.Lines {
+				p.Lines[li].Words = append([]vision.Word{}, p.Lines[li].Words...)
+			}
+			paragraphs[pos.paragraph] = p
+			copied[pos.paragraph] = true
+		}
+
+		paragraphs[pos.paragraph].Lines[pos.line].Words[pos.word].Emphasis = vision.EmphasisStrong
+	}
+
+	page.Paragraphs = paragraphs
+	return page
+}
+
+// strokeWidth returns the median length of horizontal ink runs inside the
+// rect, which is roughly the width of vertical strokes. If lightInk is true,
+// the ink is the pixels brighter than the background.
+func strokeWidth(img image.Image, rect image.Rectangle, lightInk bool) (float64, bool) {
+	rect = rect.Intersect(img.Bounds())
+	if rect.Empty() {
+		return 0, false
+	}
+
+	isInk := func(x, y int) bool {
+		lum := color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+		if lightInk {
+			return lum > inkThreshold
+		}
+		return lum < inkThreshold
+	}
+
+	var runs []int
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		var run int
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if isInk(x, y) {
+				run++
+				continue
+			}
+
+			if run > 0 {
+				runs = append(runs, run)
+				run = 0
+			}
+		}
+
+		if run > 0 {
+			runs = append(runs, run)
+		}
+	}
+
+	if len(runs) == 0 {
+		return 0, false
+	}
+
+	sort.Ints(runs)
+	return float64(runs[len(runs)/2]), true
+}
@@ -0,0 +1,215 @@
+package classify
+
+import (
+	"image"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+const (
+	// smallRatio is the max ratio of line height to the body line height
+	// for text that set in smaller type.
+	smallRatio = 0.85
+
+	// marginalRatio is the max ratio of paragraph width to the body column
+	// width for notes in the margin.
+	marginalRatio = 0.35
+
+	// minBodySymbols is the min number of symbols in a line to be used for
+	// measuring the body line height, so headings and page numbers are
+	// mostly excluded.
+	minBodySymbols = 5
+)
+
+var (
+	rxCaption    = regexp.MustCompile(`(?i)^(fig(ure)?|table|plate|chart|map|illustration|gambar|tabel)\.?\s*([0-9]+|[ivxlc]+)\b`)
+	noteMarkers  = "*†‡§¶‖#"
+	superNumbers = "⁰¹²³⁴⁵⁶⁷⁸⁹"
+)
+
+// Notes classifies the paragraphs in page that are not part of the main text
+// flow, i.e. footnotes, marginal notes and captions, then marks them by
+// setting the paragraph role. Paragraphs which already have role, e.g. the
+// running headers, are left as it is.
+func Notes(page vision.Page) vision.Page {
+	paragraphs := append([]vision.Paragraph{}, page.Paragraphs...)
+	page.Paragraphs = paragraphs
+
+	body := measureBody(paragraphs)
+	if body.column.Empty() {
+		return page
+	}
+
+	// Classify each paragraph
+	for i, p := range paragraphs {
+		if p.Role != "" {
+			continue
+		}
+
+		rect := p.BoundingBox
+		ratio := body.ratios[i]
+		small := ratio < smallRatio
+
+		switch {
+		case (small || len(p.Lines) <= 3) && rxCaption.MatchString(strings.TrimSpace(p.Text())):
+			paragraphs[i].Role = vision.RoleCaption
+
+		case isMarginal(rect, body.column):
+			paragraphs[i].Role = vision.RoleMarginal
+
+		case (small || hasNoteMarker(p)) && ratio < 1 &&
+			midY(rect) > midY(body.column) && !hasBodyBelow(rect, body.rects):
+			paragraphs[i].Role = vision.RoleFootnote
+		}
+	}
+
+	return page
+}
+
+// bodyMetrics is the measurement of the main text in page.
+type bodyMetrics struct {
+	// lineHeight is the median height of the long lines.
+	lineHeight int
+
+	// ratios is the ratio of each paragraph line height to lineHeight.
+	ratios []float64
+
+	// rects is the bounding box of paragraphs in normal size.
+	rects []image.Rectangle
+
+	// column is the area covered by the wide paragraphs in normal size, so
+	// notes in margin are excluded. It's empty if body can't be measured.
+	column image.Rectangle
+}
+
+// measureBody measures the main text from paragraphs which don't have role.
+func measureBody(paragraphs []vision.Paragraph) bodyMetrics {
+	// Measure the body line height from the long lines
+	var heights []int
+	for _, p := range paragraphs {
+		if p.Role != "" {
+			continue
+		}
+
+		for _, l := range p.Lines {
+			if countLineSymbols(l) >= minBodySymbols {
+				heights = append(heights, lineHeight(l))
+			}
+		}
+	}
+
+	body := bodyMetrics{lineHeight: median(heights)}
+	if body.lineHeight == 0 {
+		return body
+	}
+
+	// Find the body paragraphs, i.e. the ones in normal size
+	body.ratios = make([]float64, len(paragraphs))
+	var maxWidth int
+	for i, p := range paragraphs {
+		body.ratios[i] = float64(paragraphHeight(p)) / float64(body.lineHeight)
+		if p.Role == "" && body.ratios[i] >= smallRatio {
+			body.rects = append(body.rects, p.BoundingBox)
+			maxWidth = max(maxWidth, p.BoundingBox.Dx())
+		}
+	}
+
+	for _, rect := range body.rects {
+		if rect.Dx()*2 >= maxWidth {
+			body.column = body.column.Union(rect)
+		}
+	}
+
+	return body
+}
+
+// isMarginal checks whether the paragraph is narrow and mostly placed
+// outside the body column.
+func isMarginal(rect, column image.Rectangle) bool {
+	if float64(rect.Dx()) > float64(column.Dx())*marginalRatio {
+		return false
+	}
+
+	inside := rect.Intersect(image.Rect(column.Min.X, rect.Min.Y, column.Max.X, rect.Max.Y))
+	return inside.Dx()*2 < rect.Dx()
+}
+
+// hasBodyBelow checks whether there are body text below the paragraph in
+// the same column, since footnotes are placed after the main text.
+func hasBodyBelow(rect image.Rectangle, body []image.Rectangle) bool {
+	for _, b := range body {
+		overlapX := b.Min.X < rect.Max.X && b.Max.X > rect.Min.X
+		if overlapX && b.Min.Y >= rect.Max.Y {
+			return true
+		}
+	}
+	return false
+}
+
+// hasNoteMarker checks whether the paragraph starts with footnote marker,
+// either a note symbol or a raised number that smaller than the rest of
+// the line.
+func hasNoteMarker(p vision.Paragraph) bool {
+	if len(p.Lines) == 0 || len(p.Lines[0].Words) == 0 {
+		return false
+	}
+
+	line := p.Lines[0]
+	symbols := line.Words[0].Symbols
+	if len(symbols) == 0 {
+		return false
+	}
+
+	first := symbols[0]
+	if strings.ContainsAny(first.Text, noteMarkers+superNumbers) {
+		return true
+	}
+
+	// Compare the first symbol with the median symbol in line
+	var heights []int
+	for _, w := range line.Words {
+		for _, s := range w.Symbols {
+			heights = append(heights, s.BoundingBox.Dy())
+		}
+	}
+
+	rect := first.BoundingBox
+	lineMid := midY(line.BoundingBox)
+	return rect.Dy()*4 < median(heights)*3 && midY(rect) < lineMid
+}
+
+// lineHeight returns the thickness of line, so it works for both horizontal
+// and vertical text.
+func lineHeight(l vision.Line) int {
+	size := l.BoundingBox.Size()
+	return min(size.X, size.Y)
+}
+
+func paragraphHeight(p vision.Paragraph) int {
+	var heights []int
+	for _, l := range p.Lines {
+		heights = append(heights, lineHeight(l))
+	}
+	return median(heights)
+}
+
+func countLineSymbols(l vision.Line) int {
+	var n int
+	for _, w := range l.Words {
+		n += len(w.Symbols)
+	}
+	return n
+}
+
+func median(values []int) int {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]int{}, values...)
+	sort.Ints(sorted)
+	return sorted[len(sorted)/2]
+}
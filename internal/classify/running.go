@@ -0,0 +1,247 @@
+package classify
+
+import (
+	"image"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+// bandRatio is the height ratio of the top and bottom band of page, where
+// the running headers and footers are looked for.
+const bandRatio = 0.12
+
+// pageWindow is the number of pages before and after a page that checked
+// for repeating text, so running heads that alternate between odd and even
+// pages are found as well.
+const pageWindow = 4
+
+// minSimilarity is the min similarity for two texts to be considered the
+// same, which gives some room for OCR mistakes.
+const minSimilarity = 0.8
+
+var rxFolio = regexp.MustCompile(`(?i)^\W*(?:page|hal\.?|halaman|p\.)?\s*(\d+|[ivxlcdm]+)\W*$`)
+
+// candidate is a paragraph in the top or bottom band of a page, which might
+// be a running header, footer or page number.
+type candidate struct {
+	page      int
+	paragraph int
+	bottom    bool
+	text      string
+	number    int
+	hasNumber bool
+}
+
+// RunningElements detects the running headers, footers and page numbers in
+// pages, then marks them by setting the paragraph role. They are found by
+// looking for paragraphs near the top and bottom of page whose text repeats
+// or counts up across pages. The other pages, e.g. the ones converted in the
+// previous run, are checked together with pages, and both are returned with
+// their roles in their original order.
+func RunningElements(pages []vision.Page, others []vision.Page) ([]vision.Page, []vision.Page) {
+	// Put all pages in order, while remembering where each one came from
+	type entry struct {
+		page  vision.Page
+		index int
+		other bool
+	}
+
+	var entries []entry
+	for i, p := range pages {
+		p.Paragraphs = append([]vision.Paragraph{}, p.Paragraphs...)
+		entries = append(entries, entry{p, i, false})
+	}
+	for i, p := range others {
+		p.Paragraphs = append([]vision.Paragraph{}, p.Paragraphs...)
+		entries = append(entries, entry{p, i, true})
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].page.Image < entries[b].page.Image
+	})
+
+	// Collect the candidates from each page
+	var candidates []candidate
+	for i, e := range entries {
+		candidates = append(candidates, findCandidates(i, e.page)...)
+	}
+
+	// Check each candidate against the ones in nearby pages
+	for _, c := range candidates {
+		var numbered, repeated bool
+		for _, other := range candidates {
+			distance := other.page - c.page
+			if distance == 0 || distance < -pageWindow || distance > pageWindow {
+				continue
+			}
+
+			if c.hasNumber && other.hasNumber && other.number-c.number == distance {
+				numbered = true
+			}
+
+			if c.text != "" && c.bottom == other.bottom && similarity(c.text, other.text) >= minSimilarity {
+				repeated = true
+			}
+		}
+
+		var role string
+		switch {
+		case numbered:
+			role = vision.RolePageNumber
+		case repeated && c.bottom:
+			role = vision.RoleFooter
+		case repeated:
+			role = vision.RoleHeader
+		default:
+			continue
+		}
+
+		entries[c.page].page.Paragraphs[c.paragraph].Role = role
+	}
+
+	// Return the pages in their original order
+	result := make([]vision.Page, len(pages))
+	otherResult := make([]vision.Page, len(others))
+	for _, e := range entries {
+		if e.other {
+			otherResult[e.index] = e.page
+		} else {
+			result[e.index] = e.page
+		}
+	}
+
+	return result, otherResult
+}
+
+func findCandidates(pageIdx int, page vision.Page) []candidate {
+	// Use the page bounds, or the content bounds if it's not known
+	bounds := page.BoundingBox
+	if bounds.Empty() {
+		for _, p := range page.Paragraphs {
+			bounds = bounds.Union(p.BoundingBox)
+		}
+	}
+
+	bandHeight := int(float64(bounds.Dy()) * bandRatio)
+	topLimit := bounds.Min.Y + bandHeight
+	bottomLimit := bounds.Max.Y - bandHeight
+
+	var candidates []candidate
+	for i, p := range page.Paragraphs {
+		y := midY(p.BoundingBox)
+		if y > topLimit && y < bottomLimit {
+			continue
+		}
+
+		text := p.Text()
+		c := candidate{
+			page:      pageIdx,
+			paragraph: i,
+			bottom:    y >= bottomLimit,
+			text:      normalizeText(text),
+		}
+
+		// Page number that is part of running head, e.g. "12 THE HISTORY OF
+		// ROME", is ignored here since the rest of text will be repeated.
+		if m := rxFolio.FindStringSubmatch(text); m != nil {
+			c.number, c.hasNumber = parseNumber(m[1])
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates
+}
+
+// normalizeText only keeps the letters in lower case, since the digits in
+// running heads are usually the page number which changes in each page.
+func normalizeText(s string) string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// parseNumber parses arabic or roman number. Roman number is only accepted
+// when it's in canonical form, so words like "mix" won't be taken.
+func parseNumber(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, true
+	}
+
+	values := map[byte]int{'i': 1, 'v': 5, 'x': 10, 'l': 50, 'c': 100, 'd': 500, 'm': 1000}
+	lower := strings.ToLower(s)
+
+	var n int
+	for i := 0; i < len(lower); i++ {
+		value := values[lower[i]]
+		if i+1 < len(lower) && value < values[lower[i+1]] {
+			n -= value
+		} else {
+			n += value
+		}
+	}
+
+	if n < 1 || n >= 200 || toRoman(n) != lower {
+		return 0, false
+	}
+
+	return n, true
+}
+
+func toRoman(n int) string {
+	numerals := []struct {
+		value  int
+		symbol string
+	}{
+		{100, "c"}, {90, "xc"}, {50, "l"}, {40, "xl"},
+		{10, "x"}, {9, "ix"}, {5, "v"}, {4, "iv"}, {1, "i"},
+	}
+
+	var sb strings.Builder
+	for _, numeral := range numerals {
+		for n >= numeral.value {
+			sb.WriteString(numeral.symbol)
+			n -= numeral.value
+		}
+	}
+	return sb.String()
+}
+
+// similarity returns the ratio of the Levenshtein distance of two texts
+// relative to the longer one, where 1 means they are equal.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return 1 - float64(previous[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+func midY(rect image.Rectangle) int {
+	return rect.Min.Y + rect.Dy()/2
+}
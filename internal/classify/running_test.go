@@ -0,0 +1,202 @@
+package classify
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+var (
+	topBand    = image.Rect(100, 50, 900, 80)
+	bodyBlock  = image.Rect(100, 300, 900, 1000)
+	bottomBand = image.Rect(450, 1340, 550, 1370)
+)
+
+// textParagraph creates a paragraph with one line, where each word has one
+// symbol for each character.
+func textParagraph(text string, rect image.Rectangle) vision.Paragraph {
+	var words []vision.Word
+	for _, field := range strings.Fields(text) {
+		var symbols []vision.Symbol
+		for _, r := range field {
+			symbols = append(symbols, vision.Symbol{Text: string(r)})
+		}
+		words = append(words, vision.Word{Symbols: symbols, BoundingBox: rect})
+	}
+
+	return vision.Paragraph{
+		Lines:       []vision.Line{{Words: words, BoundingBox: rect}},
+		BoundingBox: rect,
+	}
+}
+
+// bookPages creates pages with the specified header and footer, which are
+// skipped if empty. Each page has different body text.
+func bookPages(headers, footers []string) []vision.Page {
+	var pages []vision.Page
+	for i := range headers {
+		page := vision.Page{
+			Image:       fmt.Sprintf("page-%02d.png", i+1),
+			BoundingBox: image.Rect(0, 0, 1000, 1400),
+		}
+
+		if headers[i] != "" {
+			page.Paragraphs = append(page.Paragraphs, textParagraph(headers[i], topBand))
+		}
+
+		body := fmt.Sprintf("body text number %d of the book", i+1)
+		page.Paragraphs = append(page.Paragraphs, textParagraph(body, bodyBlock))
+
+		if footers[i] != "" {
+			page.Paragraphs = append(page.Paragraphs, textParagraph(footers[i], bottomBand))
+		}
+
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// roles returns the role of header and footer in each page, where body text
+// must have no role.
+func roles(t *testing.T, pages []vision.Page) (headers, footers []string) {
+	t.Helper()
+	for _, page := range pages {
+		var header, footer string
+		for _, p := range page.Paragraphs {
+			switch p.BoundingBox {
+			case topBand:
+				header = p.Role
+			case bottomBand:
+				footer = p.Role
+			default:
+				if p.Role != "" {
+					t.Errorf("%s: body marked as %s", page.Image, p.Role)
+				}
+			}
+		}
+		headers = append(headers, header)
+		footers = append(footers, footer)
+	}
+	return headers, footers
+}
+
+func TestRunningElements(t *testing.T) {
+	none := []string{"", "", "", "", "", ""}
+
+	tests := []struct {
+		name        string
+		headers     []string
+		footers     []string
+		wantHeaders []string
+		wantFooters []string
+	}{{
+		name:        "roman folios",
+		headers:     none,
+		footers:     []string{"i", "ii", "iii", "iv", "v", "vi"},
+		wantHeaders: none,
+		wantFooters: []string{"page-number", "page-number", "page-number", "page-number", "page-number", "page-number"},
+	}, {
+		name:        "arabic folios with prefix",
+		headers:     none,
+		footers:     []string{"Page 11", "Page 12", "Page 13", "Page 14", "Page 15", "Page 16"},
+		wantHeaders: none,
+		wantFooters: []string{"page-number", "page-number", "page-number", "page-number", "page-number", "page-number"},
+	}, {
+		name: "odd and even headers",
+		headers: []string{
+			"THE HISTORY OF ROME", "CHAPTER ONE: THE KINGS",
+			"THE HISTORY OF ROME", "CHAPTER ONE: THE KINGS",
+			"THE HISTORY OF ROME", "CHAPTER ONE: THE KINGS",
+		},
+		footers:     none,
+		wantHeaders: []string{"header", "header", "header", "header", "header", "header"},
+		wantFooters: none,
+	}, {
+		name:        "headers with page number",
+		headers:     []string{"12 THE HISTORY OF ROME", "13 THE HISTORY OF ROME", "14 THE HISTORY OF ROME", "", "", ""},
+		footers:     none,
+		wantHeaders: []string{"header", "header", "header", "", "", ""},
+		wantFooters: none,
+	}, {
+		name:        "text that doesn't repeat",
+		headers:     []string{"Preface", "", "", "Introduction", "", ""},
+		footers:     []string{"", "", "1", "", "", "7"},
+		wantHeaders: none,
+		wantFooters: none,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages, _ := RunningElements(bookPages(tt.headers, tt.footers), nil)
+			headers, footers := roles(t, pages)
+
+			for i := range pages {
+				if headers[i] != tt.wantHeaders[i] {
+					t.Errorf("page %d: got header role %q, want %q", i+1, headers[i], tt.wantHeaders[i])
+				}
+				if footers[i] != tt.wantFooters[i] {
+					t.Errorf("page %d: got footer role %q, want %q", i+1, footers[i], tt.wantFooters[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunningElementsWithOthers(t *testing.T) {
+	all := bookPages(
+		[]string{"", "", "", "", "", ""},
+		[]string{"ix", "x", "xi", "xii", "xiii", "xiv"})
+
+	// The pages are split and shuffled, but each one must be returned in
+	// its own order with the roles from the whole book.
+	pages := []vision.Page{all[3], all[1]}
+	others := []vision.Page{all[5], all[0], all[2], all[4]}
+
+	gotPages, gotOthers := RunningElements(pages, others)
+	for i, page := range append(gotPages, gotOthers...) {
+		want := append(pages, others...)[i].Image
+		if page.Image != want {
+			t.Errorf("result %d: got %s, want %s", i, page.Image, want)
+		}
+
+		_, footers := roles(t, []vision.Page{page})
+		if footers[0] != vision.RolePageNumber {
+			t.Errorf("%s: got footer role %q, want page number", page.Image, footers[0])
+		}
+	}
+
+	// The input pages are not modified
+	for _, page := range all {
+		for _, p := range page.Paragraphs {
+			if p.Role != "" {
+				t.Errorf("%s: input page is modified", page.Image)
+			}
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text   string
+		want   int
+		wantOK bool
+	}{
+		{"12", 12, true},
+		{"iv", 4, true},
+		{"XIV", 14, true},
+		{"cxcix", 199, true},
+		{"iiii", 0, false},
+		{"mix", 0, false},
+		{"cc", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseNumber(tt.text)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseNumber(%q) = %d, %v; want %d, %v", tt.text, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
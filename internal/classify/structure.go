@@ -0,0 +1,118 @@
+package classify
+
+import (
+	"image"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+// Min ratio of line height to the body line height for each heading level.
+var headingRatios = []float64{1.8, 1.4, 1.15}
+
+const (
+	// maxHeadingLines is the max number of lines in a heading.
+	maxHeadingLines = 3
+
+	// centerTolerance is the max distance of paragraph center from the body
+	// column center, relative to the column width, to be considered centered.
+	centerTolerance = 0.05
+
+	// quoteIndent is the min indentation on both sides of block quote,
+	// relative to the body column width.
+	quoteIndent = 0.04
+)
+
+// rxListItem matches the bullet or number of list item. Letter is only
+// accepted with parenthesis, e.g. "a)" or "(a)", since letter with dot is
+// usually an initial of name, e.g. "J. Smith".
+var rxListItem = regexp.MustCompile(`^(?:[•·▪◦●○■□►➢–*-]|\(?\d{1,3}[.)]|\(?[a-zA-Z]\))\s+\S`)
+
+// Structure finds the structure of main text, i.e. the headings, list items
+// and block quotes, then marks them by setting the paragraph role. Headings
+// are found from their line height relative to the body text, or from short
+// centered lines in capital. Paragraphs which already have role are left as
+// it is.
+func Structure(page vision.Page) vision.Page {
+	paragraphs := append([]vision.Paragraph{}, page.Paragraphs...)
+	page.Paragraphs = paragraphs
+
+	body := measureBody(paragraphs)
+	if body.column.Empty() {
+		return page
+	}
+
+	column := body.column
+	for i, p := range paragraphs {
+		if p.Role != "" {
+			continue
+		}
+
+		text := strings.TrimSpace(p.Text())
+		ratio := body.ratios[i]
+		rect := p.BoundingBox
+
+		// Check for heading
+		if level := headingLevel(p, text, ratio, rect, column); level > 0 {
+			paragraphs[i].Role = vision.RoleHeading
+			paragraphs[i].Level = level
+			continue
+		}
+
+		// Check for list item and block quote
+		leftIndent := float64(rect.Min.X-column.Min.X) / float64(column.Dx())
+		rightIndent := float64(column.Max.X-rect.Max.X) / float64(column.Dx())
+
+		switch {
+		case rxListItem.MatchString(text):
+			paragraphs[i].Role = vision.RoleListItem
+		case len(p.Lines) >= 2 && ratio <= 1.05 &&
+			leftIndent >= quoteIndent && rightIndent >= quoteIndent:
+			paragraphs[i].Role = vision.RoleQuote
+		}
+	}
+
+	return page
+}
+
+func headingLevel(p vision.Paragraph, text string, ratio float64, rect, column image.Rectangle) int {
+	if len(p.Lines) > maxHeadingLines || text == "" {
+		return 0
+	}
+
+	for i, minRatio := range headingRatios {
+		if ratio >= minRatio {
+			return i + 1
+		}
+	}
+
+	// Short centered line in capital is usually heading as well
+	centerOffset := math.Abs(float64(midX(rect) - midX(column)))
+	centered := centerOffset <= float64(column.Dx())*centerTolerance && rect.Dx()*5 <= column.Dx()*4
+	if centered && len(p.Lines) <= 2 && isUpperCase(text) {
+		return len(headingRatios)
+	}
+
+	return 0
+}
+
+// isUpperCase checks whether all letters in text are in upper case.
+func isUpperCase(text string) bool {
+	var hasLetter bool
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			if !unicode.IsUpper(r) {
+				return false
+			}
+			hasLetter = true
+		}
+	}
+	return hasLetter
+}
+
+func midX(rect image.Rectangle) int {
+	return rect.Min.X + rect.Dx()/2
+}
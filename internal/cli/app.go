@@ -1,30 +1,55 @@
 package cli
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/classify"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/dehyphen"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/epub"
 	"github.com/RadhiFadlillah/vision-my-pdf/internal/montage"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/order"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/preprocess"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/storage"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/table"
 	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
 
+// Exit code when some pages failed but the rest still converted.
+const exitPartialFailure = 3
+
 func NewApp() *cli.App {
 	return &cli.App{
 		Name:      "vision-my-pdf",
 		Usage:     "generate HOCR using Google Vision API, to be used with OCRmyPDF",
 		UsageText: "vision-my-pdf [flags] ocrmypdf-dir",
 		Flags:     appFlags,
+		Before:    appBeforeHandler(),
 		Action:    appActionHandler(),
 	}
 }
 
+func appBeforeHandler() cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		// Apply config file, explicit flags still override it
+		if err := applyConfig(c); err != nil {
+			return err
+		}
+
+		// Prepare logger
+		return prepareLogger(c)
+	}
+}
+
 func appActionHandler() cli.ActionFunc {
 	return func(c *cli.Context) error {
 		// Check number of workers
@@ -54,21 +79,9 @@ func appActionHandler() cli.ActionFunc {
 		now := time.Now().Format("20060102150405")
 		cacheDir := filepath.Join(rootDir, "vision-cache")
 		debugDir := filepath.Join(rootDir, "vision-debug")
+		tablesDir := filepath.Join(rootDir, "vision-tables")
 		backupDir := filepath.Join(rootDir, fmt.Sprintf("vision-backup-%s", now))
 
-		outputDirs := []string{cacheDir}
-		if len(oldFiles) > 0 {
-			outputDirs = append(outputDirs, backupDir)
-		}
-		if c.Bool(_genDebug) {
-			outputDirs = append(outputDirs, debugDir)
-		}
-
-		err = prepareOutputDirs(outputDirs...)
-		if err != nil {
-			return err
-		}
-
 		// Adjust montage size
 		montageSize := c.Int(_montageSize)
 		if montageSize < 1 {
@@ -77,8 +90,68 @@ func appActionHandler() cli.ActionFunc {
 			montageSize = 5
 		}
 
+		// Prepare reading order
+		readingOrder := c.String(_readingOrder)
+		if c.Bool(_sortVertical) && !c.IsSet(_readingOrder) {
+			readingOrder = order.ModeVertical
+		}
+
+		if err = order.Validate(readingOrder); err != nil {
+			return err
+		}
+
+		direction := c.String(_direction)
+		if err = order.ValidateDirection(direction); err != nil {
+			return err
+		}
+
+		// Prepare preprocess pipeline
+		pipeline := preprocess.Pipeline{
+			Steps:     c.StringSlice(_preprocess),
+			TargetDPI: c.Int(_targetDPI),
+			SourceDPI: c.Int(_sourceDPI),
+			MaxSkew:   c.Int(_maxSkew),
+			CacheDir:  filepath.Join(cacheDir, "preprocess"),
+		}
+
+		if err = pipeline.Validate(); err != nil {
+			return err
+		}
+
+		// Prepare montage options
+		layout := montage.Layout{
+			Mode:      c.String(_layout),
+			Columns:   c.Int(_gridColumns),
+			Gutter:    c.Int(_gutter),
+			Separator: c.Int(_separator),
+		}
+
+		montageOpts := montage.Options{
+			Layout: layout,
+			Loader: pipeline.Load,
+			Invert: c.String(_invert),
+		}
+
+		if err = montageOpts.Validate(); err != nil {
+			return err
+		}
+
+		// Prepare upload encoding
+		encoding := montage.Encoding{
+			Mode:        c.String(_encoding),
+			JPEGQuality: c.Int(_jpegQuality),
+			MaxBytes:    c.Int64(_maxUpload),
+		}
+
+		if err = encoding.Validate(); err != nil {
+			return err
+		}
+
 		// Filter images to be montaged
 		rewriteOutput := c.Bool(_force)
+		retryQuarantine := c.Bool(_retryQuarantine)
+		var cachedImages []string
+		var quarantinedImages []string
 		var montageQueue []string
 		for _, imgPath := range imagePaths {
 			// Create absolute path to image
@@ -94,50 +167,219 @@ func appActionHandler() cli.ActionFunc {
 			if fileExist(ocrOutput) {
 				page, err := decodePageFile(ocrOutput)
 				if err == nil && page != nil && !rewriteOutput {
-					logrus.Warnf("skipped \"%s\": already converted", imgName)
+					cachedImages = append(cachedImages, absPath)
 					continue
 				}
 			}
 
+			// Skip image that failed and quarantined in previous run
+			if fileExist(quarantinePath(cacheDir, imgPath)) && !rewriteOutput && !retryQuarantine {
+				quarantinedImages = append(quarantinedImages, absPath)
+				continue
+			}
+
 			// Save this image in the queue to be montaged
 			montageQueue = append(montageQueue, absPath)
 		}
 
-		// Generate montages
-		var montages []montage.Montage
-		queueSize := len(montageQueue)
+		// Group the queued images into montages. In batch mode and async
+		// engine, each page is sent on its own so there is no need for montage.
+		engine := c.String(_engine)
+		batchSize := c.Int(_batch)
+		switch engine {
+		case engineImage:
+			if batchSize < 0 || batchSize > vision.MaxBatchSize {
+				return fmt.Errorf("batch size must be between 0 and %d", vision.MaxBatchSize)
+			}
+		case engineAsync:
+			batchSize = c.Int(_filePages)
+			if batchSize < 1 || batchSize > vision.MaxFilePages {
+				return fmt.Errorf("file pages must be between 1 and %d", vision.MaxFilePages)
+			}
+
+			// Vision only reads and writes files in GCS, so local storage
+			// can't be used here.
+			if c.String(_storage) == "" {
+				return fmt.Errorf("storage is required for async engine")
+			}
+
+			if !strings.HasPrefix(c.String(_storage), "gs://") {
+				return fmt.Errorf("storage for async engine must be in GCS, e.g. gs://bucket/prefix")
+			}
+		default:
+			return fmt.Errorf("unknown engine \"%s\"", engine)
+		}
+
+		var montageGroups [][]string
+		if batchSize > 0 {
+			montageGroups = groupImages(montageQueue, 1)
+		} else if c.Bool(_pack) {
+			budget := montage.Budget{
+				MaxPixels:   c.Int(_maxPixels),
+				MaxBytes:    c.Int64(_maxBytes),
+				MaxPages:    c.Int(_maxPages),
+				MaxLongEdge: c.Int(_maxLongEdge),
+				MaxAspect:   c.Float64(_maxAspect),
+			}
 
-		for i := 0; i < queueSize; i += montageSize {
-			limit := i + montageSize
-			if limit > queueSize {
-				limit = queueSize
+			// Preprocess steps might change the image size (e.g. deskew
+			// enlarges the canvas), so the budget uses the preprocessed
+			// images. Dry run must not write anything, so it skips the cache.
+			if len(pipeline.Steps) > 0 {
+				sizer := pipeline
+				if c.Bool(_dryRun) {
+					sizer.CacheDir = ""
+				}
+				budget.Loader = sizer.Load
+			}
+
+			montageGroups, err = montage.Pack(budget, layout, montageQueue...)
+			if err != nil {
+				return err
 			}
+		} else {
+			montageGroups = groupImages(montageQueue, montageSize)
+		}
+
+		// If this is only a dry run, print the plan then stop
+		if c.Bool(_dryRun) {
+			printDryRun(dryRunPlan{
+				CachedImages:      cachedImages,
+				QuarantinedImages: quarantinedImages,
+				MontageGroups:     montageGroups,
+				BatchSize:         batchSize,
+				OldFiles:          oldFiles,
+				BackupDir:         backupDir,
+			})
+			return nil
+		}
+
+		// Prepare report for this run
+		report := newRunReport()
+		reportOutput := filepath.Join(rootDir, "vision-report.json")
+		defer func() {
+			if err := report.save(reportOutput); err != nil {
+				logrus.Warnf("save report failed: %v", err)
+			}
+		}()
+
+		for _, imgPath := range cachedImages {
+			report.addCached(imgPath)
+			logrus.WithField("page", cleanFileName(imgPath)).Warn("skipped: already converted")
+		}
+
+		for _, imgPath := range quarantinedImages {
+			report.setQuarantined(imgPath)
+			logrus.WithField("page", cleanFileName(imgPath)).Warn("skipped: quarantined")
+		}
+
+		// Create the output dirs
+		outputDirs := []string{cacheDir, quarantineDir(cacheDir)}
+		if len(pipeline.Steps) > 0 {
+			outputDirs = append(outputDirs, pipeline.CacheDir)
+		}
+		if len(oldFiles) > 0 {
+			outputDirs = append(outputDirs, backupDir)
+		}
+		if c.Bool(_genDebug) {
+			outputDirs = append(outputDirs, debugDir)
+		}
+		if c.Bool(_tables) {
+			outputDirs = append(outputDirs, tablesDir)
+		}
+
+		err = prepareOutputDirs(outputDirs...)
+		if err != nil {
+			return err
+		}
 
-			montage, err := montage.Create(montageQueue[i:limit]...)
+		// Generate montages
+		var montages []montage.Montage
+		montageProgress := newProgress("montage", len(montageGroups))
+		for _, group := range montageGroups {
+			montage, err := montage.Create(montageOpts, group...)
 			if err != nil {
+				montageProgress.finish()
 				return err
 			}
 
 			montages = append(montages, montage)
-			logrus.Printf("generate montage for %s", montage.Name())
+			montageProgress.add(1, 0)
+			report.setMontage(montage.Name(), montage.Paths)
+			logrus.WithField("montage", cleanFileName(montage.Name())).Info("generated montage")
+		}
+		montageProgress.finish()
+
+		// Open storage for async engine
+		var asyncOpts vision.AsyncOptions
+		if engine == engineAsync {
+			st, err := storage.New(context.Background(), c.String(_storage))
+			if err != nil {
+				return fmt.Errorf("open storage failed: %w", err)
+			}
+
+			asyncOpts = vision.AsyncOptions{
+				Storage:      st,
+				Name:         "vision-" + now,
+				PollInterval: c.Duration(_pollInterval),
+			}
 		}
 
 		// Run OCR concurrently
-		pages, err := runOCR(montages, cacheDir, nWorker)
+		pages, failedImages, err := runOCR(montages, ocrOptions{
+			CacheDir:  cacheDir,
+			NWorker:   nWorker,
+			MaxRetry:  c.Int(_retry),
+			KeepGoing: c.Bool(_keepGoing),
+			Montage:   montageOpts,
+			Encoding:  encoding,
+			BatchSize: batchSize,
+			Engine:    engine,
+			Async:     asyncOpts,
+		}, report)
 		if err != nil {
 			return err
 		}
 
-		// If needed, sort paragraph vertically
-		if c.Bool(_sortVertical) {
-			for i := range pages {
-				sort.SliceStable(pages[i].Paragraphs, func(a, b int) bool {
-					rectA := pages[i].Paragraphs[a].BoundingBox
-					rectB := pages[i].Paragraphs[b].BoundingBox
-					midA := getMidPoint(rectA)
-					midB := getMidPoint(rectB)
-					return midB.Y > midA.Y
-				})
+		// Load the pages converted in the previous runs, and count their
+		// content in report as well
+		cachedPages := loadCachedPages(cacheDir, cachedImages)
+		for _, page := range cachedPages {
+			report.setCachedPage(page)
+		}
+
+		// Detect running headers, footers and page numbers. The cached pages
+		// are included since the repetition spans across the whole book, and
+		// they are needed for the whole document output as well.
+		pages, cachedPages = classify.RunningElements(pages, cachedPages)
+
+		// Prepare dehyphenator, using word frequencies from all pages
+		dict := dehyphen.Dictionary{}
+		if dictDir := c.String(_dictDir); dictDir != "" {
+			dict, err = dehyphen.LoadDictionary(dictDir)
+			if err != nil {
+				return err
+			}
+		}
+
+		allPages := append(append([]vision.Page{}, pages...), cachedPages...)
+		dh := dehyphen.New(dict, c.String(_language), allPages)
+
+		// Classify the notes and structure in each page, find the emphasis for
+		// Markdown, mark the hyphen breaks, detect text direction, then sort
+		// paragraphs following the reading order
+		for _, list := range [][]vision.Page{pages, cachedPages} {
+			for i := range list {
+				list[i] = classify.Notes(list[i])
+				list[i] = classify.Structure(list[i])
+				if c.Bool(_markdown) {
+					list[i] = detectEmphasis(list[i])
+				}
+				list[i] = dh.Apply(list[i])
+				list[i] = order.SetDirection(list[i], direction, c.String(_language))
+				if readingOrder != order.ModeVision {
+					list[i] = order.Sort(readingOrder, list[i].Direction, list[i])
+				}
 			}
 		}
 
@@ -151,30 +393,137 @@ func appActionHandler() cli.ActionFunc {
 			}
 		}
 
+		// Prepare progress for saving outputs
+		nOutputs := 2
+		if c.Bool(_genDebug) {
+			nOutputs++
+		}
+
+		outputProgress := newProgress("output", len(pages)*nOutputs)
+		defer outputProgress.finish()
+
 		// Create text from OCR page
 		tcl := prepareTextCleaner(c)
-		err = savePagesAsText(tcl, pages, rootDir, c.Bool(_mergeNewLine))
+		err = savePagesAsText(tcl, pages, rootDir, textOptions{
+			MergeNewLine: c.Bool(_mergeNewLine),
+			KeepRunning:  c.Bool(_keepRunning),
+		}, report, outputProgress)
 		if err != nil {
 			return err
 		}
 
+		// Create text and Markdown for the whole document, including the
+		// cached pages
+		allPages = append(append([]vision.Page{}, pages...), cachedPages...)
+		sort.Slice(allPages, func(a, b int) bool {
+			return allPages[a].Image < allPages[b].Image
+		})
+
+		// Number the pages by their position in all images, so the page
+		// marks are not shifted by the pages that failed or quarantined.
+		pageNumbers := map[string]int{}
+		for i, imgPath := range imagePaths {
+			absPath, err := filepath.Abs(imgPath)
+			if err != nil {
+				absPath = imgPath
+			}
+			pageNumbers[absPath] = i + 1
+		}
+
+		hasDocument := c.Bool(_document) || c.Bool(_markdown) || c.Bool(_epub)
+		if nMissing := len(imagePaths) - len(allPages); hasDocument && nMissing > 0 {
+			logrus.Warnf("%d page(s) are missing from the whole document output", nMissing)
+		}
+
+		if c.Bool(_document) {
+			docOutput := filepath.Join(rootDir, "vision-document.txt")
+			err = saveDocumentAsText(tcl, dh, allPages, docOutput, c.Bool(_mergeNewLine))
+			if err != nil {
+				return err
+			}
+		}
+
+		if c.Bool(_markdown) {
+			mdOutput := filepath.Join(rootDir, "vision-document.md")
+			err = saveDocumentAsMarkdown(tcl, dh, allPages, pageNumbers, mdOutput, c.Bool(_pageAnchors))
+			if err != nil {
+				return err
+			}
+		}
+
+		if c.Bool(_epub) {
+			meta := epub.Metadata{
+				Title:    c.String(_title),
+				Author:   c.String(_author),
+				Language: c.String(_language),
+				Modified: time.Now(),
+			}
+
+			if meta.Title == "" {
+				meta.Title = filepath.Base(rootDir)
+			}
+
+			epubOutput := filepath.Join(rootDir, "vision-document.epub")
+			err = saveDocumentAsEPUB(tcl, dh, allPages, pageNumbers, epubOutput, meta, c.Bool(_epubFigures))
+			if err != nil {
+				return err
+			}
+		}
+
+		// Reconstruct the tables, then save them
+		var pageTables map[string][]table.Table
+		if c.Bool(_tables) {
+			pageTables = detectTables(pages)
+			err = saveTables(tcl, pages, pageTables, tablesDir, report)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Create HOCR
-		err = savePagesAsHOCR(tcl, pages, rootDir)
+		err = savePagesAsHOCR(tcl, pages, pageTables, rootDir, report, outputProgress)
 		if err != nil {
 			return err
 		}
 
 		// Generate debug images
 		if c.Bool(_genDebug) {
-			err = saveDebugImages(pages, debugDir)
+			err = saveDebugImages(pages, debugDir, report, outputProgress)
 			if err != nil {
 				return err
 			}
 		}
 
+		// If some pages failed, print summary and exit with partial failure
+		if nFailed := len(failedImages); nFailed > 0 {
+			for _, imgPath := range failedImages {
+				logrus.WithField("page", cleanFileName(imgPath)).Error("page failed")
+			}
+
+			msg := fmt.Sprintf("ocr partially failed: %d page(s) failed, %d page(s) converted", nFailed, len(pages))
+			return cli.Exit(msg, exitPartialFailure)
+		}
+
 		return nil
 	}
 }
+
+// loadCachedPages loads the OCR result of images that converted in the
+// previous run. Page that can't be loaded is skipped.
+func loadCachedPages(cacheDir string, imgPaths []string) []vision.Page {
+	var pages []vision.Page
+	for _, imgPath := range imgPaths {
+		ocrOutput := filepath.Join(cacheDir, cleanFileName(imgPath)+".json")
+		page, err := decodePageFile(ocrOutput)
+		if err != nil {
+			logrus.WithField("page", cleanFileName(imgPath)).WithError(err).Warn("load cached page failed")
+			continue
+		}
+		pages = append(pages, *page)
+	}
+	return pages
+}
+
 func decodePageFile(path string) (*vision.Page, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"os"
+	fp "path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Names of config file that will be looked up in OCRmyPDF dir
+// when config path is not specified.
+var configFileNames = []string{
+	"vision-my-pdf.yaml",
+	"vision-my-pdf.yml",
+	"vision-my-pdf.toml",
+}
+
+func applyConfig(c *cli.Context) error {
+	// Find the config file
+	configPath := c.String(_config)
+	if configPath == "" {
+		configPath = findConfigFile(c.Args().Slice())
+	}
+
+	if configPath == "" {
+		if profile := c.String(_profile); profile != "" {
+			return fmt.Errorf("profile \"%s\": no config file found", profile)
+		}
+		return nil
+	}
+
+	// Parse the config file
+	config, err := decodeConfigFile(configPath)
+	if err != nil {
+		return fmt.Errorf("config \"%s\": %w", configPath, err)
+	}
+
+	// Extract the profiles from config
+	profiles := map[string]map[string]any{}
+	if rawProfiles, exist := config["profiles"]; exist {
+		mapProfiles, ok := rawProfiles.(map[string]any)
+		if !ok {
+			return fmt.Errorf("config \"%s\": profiles must be a map", configPath)
+		}
+
+		for name, rawProfile := range mapProfiles {
+			profile, ok := rawProfile.(map[string]any)
+			if !ok {
+				return fmt.Errorf("config \"%s\": profile \"%s\" must be a map", configPath, name)
+			}
+			profiles[name] = profile
+		}
+	}
+
+	// Determine the profile to use. Flag has priority over the default
+	// profile that written in config.
+	profileName := c.String(_profile)
+	if profileName == "" {
+		profileName, _ = config["profile"].(string)
+	}
+
+	// Merge the base config with the selected profile
+	values := map[string]any{}
+	for key, value := range config {
+		if key != "profiles" && key != "profile" {
+			values[key] = value
+		}
+	}
+
+	if profileName != "" {
+		profile, exist := profiles[profileName]
+		if !exist {
+			return fmt.Errorf("config \"%s\": profile \"%s\" not found", configPath, profileName)
+		}
+
+		for key, value := range profile {
+			values[key] = value
+		}
+	}
+
+	// Apply config to flags that not explicitly set by user. Relative paths
+	// are resolved from the dir of config file.
+	flags := map[string]cli.Flag{}
+	for _, flag := range c.App.Flags {
+		for _, name := range flag.Names() {
+			flags[name] = flag
+		}
+	}
+
+	configDir := fp.Dir(configPath)
+	for key, value := range values {
+		flag, exist := flags[key]
+		if !exist || flag.Names()[0] == _config || flag.Names()[0] == _profile {
+			return fmt.Errorf("config \"%s\": unknown flag \"%s\"", configPath, key)
+		}
+
+		if c.IsSet(flag.Names()[0]) {
+			continue
+		}
+
+		if err = setFlagValue(c, flag, configDir, value); err != nil {
+			return fmt.Errorf("config \"%s\": flag \"%s\": %w", configPath, key, err)
+		}
+	}
+
+	return nil
+}
+
+func findConfigFile(args []string) string {
+	// We only look in OCRmyPDF dir, so skip if it's not specified
+	if len(args) != 1 {
+		return ""
+	}
+
+	for _, name := range configFileNames {
+		configPath := fp.Join(args[0], name)
+		if fileExist(configPath) {
+			return configPath
+		}
+	}
+
+	return ""
+}
+
+func decodeConfigFile(path string) (map[string]any, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := map[string]any{}
+	switch strings.ToLower(fp.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(content, &config)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &config)
+	default:
+		err = fmt.Errorf("unsupported config format")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func setFlagValue(c *cli.Context, flag cli.Flag, configDir string, value any) error {
+	name := flag.Names()[0]
+
+	// For list, set each value one by one
+	if list, isList := value.([]any); isList {
+		for _, item := range list {
+			strItem, err := flagValueString(flag, configDir, item)
+			if err != nil {
+				return err
+			}
+
+			if err = c.Set(name, strItem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	strValue, err := flagValueString(flag, configDir, value)
+	if err != nil {
+		return err
+	}
+
+	return c.Set(name, strValue)
+}
+
+// flagValueString converts the config value into string for the flag. YAML
+// and TOML might decode number like 1e7 as float, so whole float is accepted
+// for integer flag. Relative path is resolved from the config dir.
+func flagValueString(flag cli.Flag, configDir string, value any) (string, error) {
+	switch flag.(type) {
+	case *cli.IntFlag, *cli.Int64Flag, *cli.UintFlag, *cli.Uint64Flag:
+		if f, isFloat := value.(float64); isFloat {
+			if f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+				return "", fmt.Errorf("%v is not an integer", value)
+			}
+			return strconv.FormatInt(int64(f), 10), nil
+		}
+
+	case *cli.PathFlag:
+		if path, isString := value.(string); isString && path != "" && !fp.IsAbs(path) {
+			return fp.Join(configDir, path), nil
+		}
+	}
+
+	return fmt.Sprint(value), nil
+}
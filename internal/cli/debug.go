@@ -12,21 +12,22 @@ import (
 	"github.com/tdewolff/canvas/renderers"
 )
 
-func saveDebugImages(pages []vision.Page, outputDir string) error {
+func saveDebugImages(pages []vision.Page, outputDir string, report *runReport, prog *progress) error {
 	// Prepare font
 	roboto := canvas.NewFontFamily("Roboto")
 	roboto.MustLoadSystemFont("Roboto", canvas.FontBold)
 
 	for _, page := range pages {
-		if err := saveDebugImage(page, roboto, outputDir); err != nil {
+		if err := saveDebugImage(page, roboto, outputDir, report); err != nil {
 			return err
 		}
+		prog.add(1, 0)
 	}
 
 	return nil
 }
 
-func saveDebugImage(page vision.Page, fontFamily *canvas.FontFamily, outputDir string) error {
+func saveDebugImage(page vision.Page, fontFamily *canvas.FontFamily, outputDir string, report *runReport) error {
 	// Prepare output for this image
 	imgName := cleanFileName(page.Image)
 	debugOutput := fp.Join(outputDir, imgName) + ".png"
@@ -83,7 +84,8 @@ func saveDebugImage(page vision.Page, fontFamily *canvas.FontFamily, outputDir s
 		return fmt.Errorf("debug save error for \"%s\": %w", imgName, err)
 	}
 
-	logrus.Printf("saved debug for \"%s\"", imgName)
+	report.addOutput(page.Image, debugOutput)
+	logrus.WithField("page", imgName).Info("saved debug image")
 	return nil
 }
 
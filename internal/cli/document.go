@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	fp "path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/cleaner"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/dehyphen"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+	"github.com/sirupsen/logrus"
+)
+
+// terminalPunctuations marks the end of sentence. Closing quotes and
+// brackets after it are ignored while checking.
+const (
+	terminalPunctuations = ".!?…。！？"
+	closingPunctuations  = `"'”’»)]}」』`
+)
+
+// emphasisStart and emphasisEnd wrap the strong words in text for Markdown.
+// They are private use characters, so they never appear in OCR text, and
+// they are ignored while joining paragraphs.
+const (
+	emphasisStart = "\ue000"
+	emphasisEnd   = "\ue001"
+)
+
+// pageBreakMark marks the position of page break inside a paragraph that
+// joined across pages, so the page marker can be put exactly there.
+const pageBreakMark = "\ue002"
+
+var (
+	emphasisRemover = strings.NewReplacer(emphasisStart, "", emphasisEnd, "")
+	markRemover     = strings.NewReplacer(emphasisStart, "", emphasisEnd, "", pageBreakMark, "")
+)
+
+func saveDocumentAsText(tcl cleaner.Cleaner, dh *dehyphen.Dehyphenator, pages []vision.Page, output string, mergeNewLine bool) error {
+	docText := pagesToDocument(dh, pages, mergeNewLine)
+	docText = tcl.Clean(docText)
+
+	err := os.WriteFile(output, []byte(docText), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("save document failed: %w", err)
+	}
+
+	logrus.WithField("pages", len(pages)).Debugf("saved document to %s", fp.Base(output))
+	return nil
+}
+
+// docBlock is a paragraph in the whole document, which might be joined from
+// the paragraphs in several pages.
+type docBlock struct {
+	// Paragraph is the first paragraph in block, which decides its role.
+	Paragraph vision.Paragraph
+	Text      string
+
+	// Pages is the number of pages, started from 1, that begin in this block.
+	// It's the position of page in all input images, including the ones that
+	// failed or quarantined.
+	Pages []int
+
+	// Breaks is the number of pages that begin inside Text, since the block
+	// is joined across page break. Each item is marked in Text by a
+	// pageBreakMark, in the same order.
+	Breaks [][]int
+}
+
+// buildDocument collects the paragraphs in the whole document. The running
+// headers, footers and page numbers are skipped, while the notes are returned
+// separately. Paragraph which split by page break is joined back. The pages
+// are numbered using pageNumbers, keyed by page image, so the numbers are not
+// shifted by missing pages. Page that isn't found there is numbered by its
+// position in pages.
+func buildDocument(dh *dehyphen.Dehyphenator, pages []vision.Page, pageNumbers map[string]int, mergeNewLine bool) (blocks, notes []docBlock) {
+	var pendingPages []int
+	for pageIdx, page := range pages {
+		pendingPages = append(pendingPages, pageNumber(pageNumbers, page, pageIdx))
+
+		pageStart := true
+		for _, p := range page.Paragraphs {
+			if isRunning(p) {
+				continue
+			}
+
+			text := paragraphToText(p, mergeNewLine)
+			if text == "" {
+				continue
+			}
+
+			if isNote(p) {
+				notes = append(notes, docBlock{Paragraph: p, Text: text})
+				continue
+			}
+
+			// Join the first paragraph in page with the last one before it,
+			// unless one of them is a heading.
+			if nBlock := len(blocks); pageStart && nBlock > 0 {
+				last := blocks[nBlock-1]
+				keepHyphen := func(left, right string) bool {
+					left, right = markRemover.Replace(left), markRemover.Replace(right)
+					return dh.KeepHyphen(p.Language, left, right)
+				}
+
+				joined, canJoin := joinParagraphs(last.Text, text, mergeNewLine, keepHyphen)
+				if canJoin && last.Paragraph.Role != vision.RoleHeading && p.Role != vision.RoleHeading {
+					blocks[nBlock-1].Text = markPageBreak(joined, text)
+					blocks[nBlock-1].Breaks = append(blocks[nBlock-1].Breaks, pendingPages)
+					pendingPages = nil
+					pageStart = false
+					continue
+				}
+			}
+
+			pageStart = false
+			blocks = append(blocks, docBlock{Paragraph: p, Text: text, Pages: pendingPages})
+			pendingPages = nil
+		}
+	}
+
+	// Pages at the end of document which don't have text are put in an
+	// empty block, so they are still marked.
+	if len(pendingPages) > 0 {
+		blocks = append(blocks, docBlock{Pages: pendingPages})
+	}
+
+	return blocks, notes
+}
+
+// markPageBreak puts the page break mark in the joined text, right before
+// the separator of text from the next page. If a word is split by the page
+// break, it's put after the joined word instead.
+func markPageBreak(joined, next string) string {
+	idx := len(joined) - len(next)
+	if before, size := utf8.DecodeLastRuneInString(joined[:idx]); unicode.IsSpace(before) {
+		idx -= size
+	} else if wordEnd := strings.IndexFunc(next, unicode.IsSpace); wordEnd >= 0 {
+		idx += wordEnd
+	} else {
+		idx = len(joined)
+	}
+
+	return joined[:idx] + pageBreakMark + joined[idx:]
+}
+
+// replacePageBreaks replaces each page break mark in text with the result of
+// render for the pages that begin there.
+func replacePageBreaks(text string, breaks [][]int, render func(pages []int) string) string {
+	parts := strings.Split(text, pageBreakMark)
+
+	var sb strings.Builder
+	for i, part := range parts {
+		if i > 0 && i <= len(breaks) {
+			sb.WriteString(render(breaks[i-1]))
+		}
+		sb.WriteString(part)
+	}
+
+	return sb.String()
+}
+
+// pageNumber returns the number of page from pageNumbers, or from its index
+// in the document if it's not found there.
+func pageNumber(pageNumbers map[string]int, page vision.Page, idx int) int {
+	if number, exist := pageNumbers[page.Image]; exist {
+		return number
+	}
+	return idx + 1
+}
+
+// pagesToDocument creates text for the whole document, with the notes put
+// in their sections at the end of document.
+func pagesToDocument(dh *dehyphen.Dehyphenator, pages []vision.Page, mergeNewLine bool) string {
+	blocks, notes := buildDocument(dh, pages, nil, mergeNewLine)
+
+	var sb strings.Builder
+	for _, block := range blocks {
+		if block.Text == "" {
+			continue
+		}
+
+		sb.WriteString(strings.ReplaceAll(block.Text, pageBreakMark, ""))
+		sb.WriteString("\n\n")
+	}
+
+	noteTexts := map[string][]string{}
+	for _, note := range notes {
+		noteTexts[note.Paragraph.Role] = append(noteTexts[note.Paragraph.Role], note.Text)
+	}
+
+	sb.WriteString(notesToText(noteTexts))
+	return sb.String()
+}
+
+// joinParagraphs joins two paragraphs that separated by page break, which is
+// only done if the first one doesn't end with terminal punctuation and the
+// second one starts with lower case letter. Word that hyphenated across the
+// page break is joined as well, with the hyphen removed unless keepHyphen
+// says it's a compound word.
+func joinParagraphs(first, second string, mergeNewLine bool, keepHyphen func(left, right string) bool) (string, bool) {
+	// Check the end of first paragraph
+	end := strings.TrimRight(first, closingPunctuations+emphasisEnd+pageBreakMark)
+	lastRune, _ := utf8.DecodeLastRuneInString(end)
+	if end == "" || strings.ContainsRune(terminalPunctuations, lastRune) {
+		return "", false
+	}
+
+	// Check the start of second paragraph
+	firstRune, _ := utf8.DecodeRuneInString(strings.TrimLeft(second, emphasisStart))
+	if !unicode.IsLower(firstRune) {
+		return "", false
+	}
+
+	// Join the word that split by page break
+	if prefix, hyphenated := strings.CutSuffix(first, "-"); hyphenated {
+		lastRune, _ = utf8.DecodeLastRuneInString(strings.TrimRight(prefix, emphasisEnd))
+		if unicode.IsLetter(lastRune) {
+			prefixWords, secondWords := strings.Fields(prefix), strings.Fields(second)
+			if keepHyphen(prefixWords[len(prefixWords)-1], secondWords[0]) {
+				return first + second, true
+			}
+			return prefix + second, true
+		}
+	}
+
+	separator := "\n"
+	if mergeNewLine {
+		separator = " "
+	}
+
+	return first + separator + second, true
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	fp "path/filepath"
+	"strings"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/montage"
+)
+
+// Price of document text detection in USD per 1000 units, excluding the
+// first 1000 units each month which are free.
+const visionPricePer1000 = 1.5
+
+type dryRunPlan struct {
+	CachedImages      []string
+	QuarantinedImages []string
+	MontageGroups     [][]string
+	BatchSize         int
+	OldFiles          []string
+	BackupDir         string
+}
+
+func printDryRun(plan dryRunPlan) {
+	// Print cached and pending pages
+	var nPending int
+	for _, group := range plan.MontageGroups {
+		nPending += len(group)
+	}
+
+	fmt.Printf("cached pages (%d):\n", len(plan.CachedImages))
+	for _, imgPath := range plan.CachedImages {
+		fmt.Printf("  %s\n", fp.Base(imgPath))
+	}
+
+	fmt.Printf("\nquarantined pages (%d):\n", len(plan.QuarantinedImages))
+	for _, imgPath := range plan.QuarantinedImages {
+		fmt.Printf("  %s\n", fp.Base(imgPath))
+	}
+
+	fmt.Printf("\npending pages (%d):\n", nPending)
+	for _, group := range plan.MontageGroups {
+		for _, imgPath := range group {
+			fmt.Printf("  %s\n", fp.Base(imgPath))
+		}
+	}
+
+	// Print montage groups
+	fmt.Printf("\nmontages (%d):\n", len(plan.MontageGroups))
+	for _, group := range plan.MontageGroups {
+		var names []string
+		for _, imgPath := range group {
+			names = append(names, fp.Base(imgPath))
+		}
+
+		m := montage.Montage{Paths: group}
+		fmt.Printf("  %s: %s\n", m.Name(), strings.Join(names, ", "))
+	}
+
+	// Print the old files that will be replaced
+	pendingOutputs := map[string]struct{}{}
+	for _, group := range plan.MontageGroups {
+		for _, imgPath := range group {
+			pendingOutputs[cleanFileName(imgPath)] = struct{}{}
+		}
+	}
+
+	fmt.Printf("\nold files backed up to %s (%d):\n", fp.Base(plan.BackupDir), len(plan.OldFiles))
+	for _, of := range plan.OldFiles {
+		// Old files are named "<image>_hocr.<ext>"
+		imgName := strings.TrimSuffix(cleanFileName(of), "_hocr")
+		if _, exist := pendingOutputs[imgName]; exist {
+			fmt.Printf("  %s (will be overwritten)\n", fp.Base(of))
+		} else {
+			fmt.Printf("  %s\n", fp.Base(of))
+		}
+	}
+
+	// Print the estimated cost. Each image is billed, even when several
+	// images sent in a single batch request.
+	nImages := len(plan.MontageGroups)
+	nRequests := nImages
+	if plan.BatchSize > 1 {
+		nRequests = (nImages + plan.BatchSize - 1) / plan.BatchSize
+	}
+
+	cost := float64(nImages) * visionPricePer1000 / 1000
+	fmt.Printf("\nAPI requests: %d (%d images)\n", nRequests, nImages)
+	fmt.Printf("estimated cost: $%.4f (excluding monthly free units)\n", cost)
+}
@@ -0,0 +1,377 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"html"
+	"image"
+	"image/png"
+	"os"
+	fp "path/filepath"
+	"strings"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/cleaner"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/dehyphen"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/epub"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+	"github.com/sirupsen/logrus"
+)
+
+func saveDocumentAsEPUB(tcl cleaner.Cleaner, dh *dehyphen.Dehyphenator, pages []vision.Page, pageNumbers map[string]int, output string, meta epub.Metadata, figures bool) error {
+	book, err := pagesToBook(tcl, dh, pages, pageNumbers, meta, figures)
+	if err != nil {
+		return fmt.Errorf("create EPUB failed: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err = book.Write(&buf); err != nil {
+		return fmt.Errorf("create EPUB failed: %w", err)
+	}
+
+	err = os.WriteFile(output, buf.Bytes(), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("save EPUB failed: %w", err)
+	}
+
+	logrus.WithField("pages", len(pages)).Debugf("saved EPUB to %s", fp.Base(output))
+	return nil
+}
+
+// pagesToBook creates EPUB book for the whole document. The book is split
+// into several documents at the top level headings, which are listed in the
+// table of contents along with the lower headings. Each source page is marked
+// by page break, and if figures is enabled, the pictures in page are cropped
+// and put after its page break. The notes are put in the last document.
+func pagesToBook(tcl cleaner.Cleaner, dh *dehyphen.Dehyphenator, pages []vision.Page, pageNumbers map[string]int, meta epub.Metadata, figures bool) (epub.Book, error) {
+	// Newlines are always merged, since EPUB is reflowed anyway
+	blocks, notes := buildDocument(dh, pages, pageNumbers, true)
+
+	// Complete the metadata
+	if meta.Language == "" {
+		meta.Language = documentLanguage(pages)
+	}
+
+	if meta.Identifier == "" {
+		meta.Identifier = bookIdentifier(meta, pages)
+	}
+
+	book := epub.Book{Metadata: meta}
+
+	// Use the printed page numbers as page labels, e.g. "xii" or "37"
+	pageLabels := map[int]string{}
+	for i, page := range pages {
+		if folio := pageFolio(tcl, page); folio != "" {
+			pageLabels[pageNumber(pageNumbers, page, i)] = folio
+		}
+	}
+
+	// Crop the figures
+	pageFigures := map[int][]string{}
+	if figures {
+		for i, page := range pages {
+			number := pageNumber(pageNumbers, page, i)
+			images, err := cropFigures(page, number)
+			if err != nil {
+				return epub.Book{}, err
+			}
+
+			for _, img := range images {
+				book.Images = append(book.Images, img)
+				pageFigures[number] = append(pageFigures[number], img.Name)
+			}
+		}
+	}
+
+	// Find the top level heading, which starts a new document
+	topLevel := 0
+	for _, block := range blocks {
+		if block.Paragraph.Role == vision.RoleHeading && block.Text != "" {
+			level := min(max(block.Paragraph.Level, 1), 6)
+			if topLevel == 0 || level < topLevel {
+				topLevel = level
+			}
+		}
+	}
+
+	var body strings.Builder
+	var listTag string
+	docName := func() string {
+		return fmt.Sprintf("text_%03d.xhtml", len(book.Documents)+1)
+	}
+
+	closeList := func() {
+		if listTag != "" {
+			body.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+
+	// Prepare functions to mark the page break, and to put the figures in
+	// the page
+	pageBreak := func(pageNumber int) string {
+		id := fmt.Sprintf("page_%d", pageNumber)
+		label, exist := pageLabels[pageNumber]
+		if !exist {
+			label = fmt.Sprint(pageNumber)
+		}
+
+		book.Pages = append(book.Pages, epub.PageMarker{
+			Document: docName(),
+			ID:       id,
+			Label:    label,
+		})
+
+		return fmt.Sprintf("<span epub:type=\"pagebreak\" role=\"doc-pagebreak\" id=\"%s\" title=\"%s\"/>",
+			id, html.EscapeString(label))
+	}
+
+	figureTags := func(pageNumber int) string {
+		var sb strings.Builder
+		for i, name := range pageFigures[pageNumber] {
+			sb.WriteString(fmt.Sprintf("<figure><img src=\"%s\" alt=\"Figure %d on page %d\"/></figure>\n",
+				html.EscapeString(name), i+1, pageNumber))
+		}
+		return sb.String()
+	}
+
+	docTitle := meta.Title
+	flushDocument := func() {
+		closeList()
+		book.Documents = append(book.Documents, epub.Document{
+			Name:  docName(),
+			Title: docTitle,
+			Body:  body.String(),
+		})
+		body.Reset()
+	}
+
+	for _, block := range blocks {
+		text := strings.Join(strings.Fields(tcl.Clean(block.Text)), " ")
+		isHeading := block.Paragraph.Role == vision.RoleHeading && text != ""
+		level := min(max(block.Paragraph.Level, 1), 6)
+
+		// Start a new document at the top level heading
+		if isHeading && level == topLevel && body.Len() > 0 {
+			flushDocument()
+		}
+
+		if isHeading && level == topLevel {
+			docTitle = text
+		}
+
+		// Mark the pages that begin in this block
+		if len(block.Pages) > 0 {
+			closeList()
+		}
+
+		for _, pageNumber := range block.Pages {
+			body.WriteString(pageBreak(pageNumber) + "\n")
+			body.WriteString(figureTags(pageNumber))
+		}
+
+		if text == "" {
+			continue
+		}
+
+		// Pages that begin inside this block are marked where the page break
+		// falls, while their figures are put after it.
+		var breakFigures string
+		escape := func(s string) string {
+			return replacePageBreaks(html.EscapeString(s), block.Breaks, func(pages []int) string {
+				var markers string
+				for _, pageNumber := range pages {
+					markers += pageBreak(pageNumber)
+					breakFigures += figureTags(pageNumber)
+				}
+				return markers
+			})
+		}
+
+		switch block.Paragraph.Role {
+		case vision.RoleHeading:
+			closeList()
+			id := fmt.Sprintf("heading_%d", len(book.Headings)+1)
+			body.WriteString(fmt.Sprintf("<h%d id=\"%s\">%s</h%d>\n", level, id, html.EscapeString(text), level))
+			book.Headings = append(book.Headings, epub.Heading{
+				Document: docName(),
+				ID:       id,
+				Title:    text,
+				Level:    level,
+			})
+
+		case vision.RoleListItem:
+			tag, item := "ul", text
+			if m := rxNumberItem.FindStringSubmatch(text); m != nil {
+				tag, item = "ol", text[len(m[0]):]
+			} else if m := rxBulletItem.FindString(text); m != "" {
+				item = text[len(m):]
+			}
+
+			if tag != listTag {
+				closeList()
+				body.WriteString("<" + tag + ">\n")
+				listTag = tag
+			}
+			body.WriteString("<li>" + escape(item) + "</li>\n")
+
+		case vision.RoleQuote:
+			closeList()
+			body.WriteString("<blockquote><p>" + escape(text) + "</p></blockquote>\n")
+
+		default:
+			closeList()
+			body.WriteString("<p>" + escape(text) + "</p>\n")
+		}
+
+		if breakFigures != "" {
+			closeList()
+			body.WriteString(breakFigures)
+		}
+	}
+
+	if body.Len() > 0 || len(book.Documents) == 0 {
+		flushDocument()
+	}
+
+	// Put the notes in their sections at the last document
+	for _, section := range noteSections {
+		var sectionNotes []string
+		for _, note := range notes {
+			if note.Paragraph.Role == section.role {
+				text := strings.Join(strings.Fields(tcl.Clean(note.Text)), " ")
+				sectionNotes = append(sectionNotes, text)
+			}
+		}
+
+		if len(sectionNotes) == 0 {
+			continue
+		}
+
+		id := fmt.Sprintf("heading_%d", len(book.Headings)+1)
+		body.WriteString(fmt.Sprintf("<section>\n<h2 id=\"%s\">%s</h2>\n", id, html.EscapeString(section.title)))
+		for _, text := range sectionNotes {
+			body.WriteString("<p>" + html.EscapeString(text) + "</p>\n")
+		}
+		body.WriteString("</section>\n")
+
+		book.Headings = append(book.Headings, epub.Heading{
+			Document: docName(),
+			ID:       id,
+			Title:    section.title,
+			Level:    max(topLevel, 1),
+		})
+	}
+
+	if body.Len() > 0 {
+		docTitle = "Notes"
+		flushDocument()
+	}
+
+	return book, nil
+}
+
+// pageFolio returns the page number that printed in page, as detected from
+// the running elements. It returns empty string if there is none.
+func pageFolio(tcl cleaner.Cleaner, page vision.Page) string {
+	for _, p := range page.Paragraphs {
+		if p.Role == vision.RolePageNumber {
+			return strings.Join(strings.Fields(tcl.Clean(p.Text())), " ")
+		}
+	}
+	return ""
+}
+
+// cropFigures crops the pictures marked by Vision from the page image. The
+// images are named by the page number instead of the image name, since the
+// name is used as URL in the book, e.g. "images/fig_12_1.png".
+func cropFigures(page vision.Page, pageNumber int) ([]epub.Image, error) {
+	var regions []image.Rectangle
+	for _, r := range page.Regions {
+		if r.Type == vision.RegionPicture {
+			regions = append(regions, r.BoundingBox)
+		}
+	}
+
+	if len(regions) == 0 {
+		return nil, nil
+	}
+
+	imgName := cleanFileName(page.Image)
+	f, err := os.Open(page.Image)
+	if err != nil {
+		return nil, fmt.Errorf("figure open error for \"%s\": %w", imgName, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("figure decode error for \"%s\": %w", imgName, err)
+	}
+
+	subImager, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("figure crop error for \"%s\": unsupported image", imgName)
+	}
+
+	var images []epub.Image
+	for _, rect := range regions {
+		rect = rect.Intersect(img.Bounds())
+		if rect.Empty() {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err = png.Encode(&buf, subImager.SubImage(rect)); err != nil {
+			return nil, fmt.Errorf("figure encode error for \"%s\": %w", imgName, err)
+		}
+
+		images = append(images, epub.Image{
+			Name:      fmt.Sprintf("images/fig_%d_%d.png", pageNumber, len(images)+1),
+			MediaType: "image/png",
+			Data:      buf.Bytes(),
+		})
+	}
+
+	return images, nil
+}
+
+// documentLanguage returns the language that used by most symbols in the
+// document, or "und" if Vision doesn't detect any language.
+func documentLanguage(pages []vision.Page) string {
+	counts := map[string]int{}
+	for _, page := range pages {
+		for _, p := range page.Paragraphs {
+			if p.Language != "" {
+				counts[p.Language] += len([]rune(p.Text()))
+			}
+		}
+	}
+
+	language, maxCount := "und", 0
+	for lang, count := range counts {
+		if count > maxCount || (count == maxCount && lang < language) {
+			language, maxCount = lang, count
+		}
+	}
+
+	return language
+}
+
+// bookIdentifier creates a name-based UUID from the metadata and the page
+// images, so the same document always has the same identifier.
+func bookIdentifier(meta epub.Metadata, pages []vision.Page) string {
+	h := sha1.New()
+	fmt.Fprintln(h, meta.Title)
+	fmt.Fprintln(h, meta.Author)
+	for _, page := range pages {
+		fmt.Fprintln(h, fp.Base(page.Image))
+	}
+
+	sum := h.Sum(nil)
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -2,20 +2,70 @@ package cli
 
 import (
 	"runtime"
+	"time"
 
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/montage"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/order"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/preprocess"
 	"github.com/urfave/cli/v2"
 )
 
 const (
+	// Flag names for config
+	_config  = "config"
+	_profile = "profile"
+
 	// Flag names for app worker and output
-	_force       = "force"
-	_worker      = "worker"
-	_genDebug    = "gen-debug"
-	_montageSize = "montage"
+	_force           = "force"
+	_worker          = "worker"
+	_genDebug        = "gen-debug"
+	_montageSize     = "montage"
+	_pack            = "pack"
+	_batch           = "batch"
+	_engine          = "engine"
+	_storage         = "storage"
+	_filePages       = "file-pages"
+	_pollInterval    = "poll-interval"
+	_maxPixels       = "max-pixels"
+	_maxBytes        = "max-bytes"
+	_maxPages        = "max-pages"
+	_maxLongEdge     = "max-long-edge"
+	_maxAspect       = "max-aspect"
+	_layout          = "layout"
+	_gridColumns     = "grid-columns"
+	_gutter          = "gutter"
+	_separator       = "separator"
+	_invert          = "invert"
+	_encoding        = "encoding"
+	_jpegQuality     = "jpeg-quality"
+	_maxUpload       = "max-upload"
+	_preprocess      = "preprocess"
+	_targetDPI       = "target-dpi"
+	_sourceDPI       = "source-dpi"
+	_maxSkew         = "max-skew"
+	_dryRun          = "dry-run"
+	_retry           = "retry"
+	_keepGoing       = "keep-going"
+	_retryQuarantine = "retry-quarantine"
+	_logFormat       = "log-format"
+	_logLevel        = "log-level"
 
 	// Flag names for OCR parameters
+	_readingOrder = "reading-order"
 	_sortVertical = "sort-vertical"
+	_direction    = "direction"
+	_language     = "language"
 	_mergeNewLine = "merge-newline"
+	_keepRunning  = "keep-running"
+	_document     = "document"
+	_dictDir      = "dict-dir"
+	_markdown     = "markdown"
+	_pageAnchors  = "page-anchors"
+	_tables       = "tables"
+	_epub         = "epub"
+	_epubFigures  = "epub-figures"
+	_title        = "title"
+	_author       = "author"
 
 	// Flag names for text cleaner
 	_noDiacritic      = "no-diacritic"
@@ -33,6 +83,17 @@ const (
 )
 
 var appFlags = []cli.Flag{
+	// Flags for config
+	&cli.StringFlag{
+		Name:  _config,
+		Usage: "path to YAML or TOML config file (default: vision-my-pdf.{yaml,yml,toml} in ocrmypdf-dir)",
+	},
+	&cli.StringFlag{
+		Name:    _profile,
+		Aliases: []string{"p"},
+		Usage:   "name of profile in config file to use",
+	},
+
 	// Flags for app worker and output
 	&cli.BoolFlag{
 		Name:    _force,
@@ -56,18 +117,209 @@ var appFlags = []cli.Flag{
 		Usage:   "montage image size (must be between 1 and 5)",
 		Value:   1,
 	},
+	&cli.BoolFlag{
+		Name:  _pack,
+		Usage: "pack pages into montages by pixel and byte budget, ignoring montage size",
+	},
+	&cli.IntFlag{
+		Name:  _batch,
+		Usage: "send this many pages per request using batch API instead of montage (max 16)",
+	},
+	&cli.StringFlag{
+		Name:  _engine,
+		Usage: "OCR engine, either image (montage or batch of images) or async (PDF file in storage)",
+		Value: engineImage,
+	},
+	&cli.StringFlag{
+		Name:  _storage,
+		Usage: "GCS storage for async engine, e.g. gs://bucket/prefix",
+	},
+	&cli.IntFlag{
+		Name:  _filePages,
+		Usage: "number of pages per PDF file for async engine",
+		Value: 100,
+	},
+	&cli.DurationFlag{
+		Name:  _pollInterval,
+		Usage: "interval to check status of async OCR",
+		Value: 10 * time.Second,
+	},
+	&cli.IntFlag{
+		Name:  _maxPixels,
+		Usage: "max pixels of packed montage",
+		Value: 40_000_000,
+	},
+	&cli.Int64Flag{
+		Name:  _maxBytes,
+		Usage: "max bytes of packed montage, estimated from the source images",
+		Value: montage.MaxAPIBytes,
+	},
+	&cli.IntFlag{
+		Name:  _maxPages,
+		Usage: "max number of pages in packed montage",
+		Value: montage.DefaultMaxPages,
+	},
+	&cli.IntFlag{
+		Name:  _maxLongEdge,
+		Usage: "max length in pixels of the longer side of packed montage",
+		Value: montage.DefaultMaxLongEdge,
+	},
+	&cli.Float64Flag{
+		Name:  _maxAspect,
+		Usage: "max ratio of the longer side to the shorter side of packed montage",
+		Value: montage.DefaultMaxAspect,
+	},
+	&cli.StringFlag{
+		Name:  _layout,
+		Usage: "montage layout, one of vertical, horizontal or grid",
+		Value: montage.LayoutVertical,
+	},
+	&cli.IntFlag{
+		Name:  _gridColumns,
+		Usage: "number of columns for grid layout (default: square grid)",
+	},
+	&cli.IntFlag{
+		Name:  _gutter,
+		Usage: "gap in pixels between images in montage",
+	},
+	&cli.IntFlag{
+		Name:  _separator,
+		Usage: "thickness in pixels of separator bar drawn inside the gutter",
+	},
+	&cli.StringFlag{
+		Name:  _invert,
+		Usage: "invert colors before OCR, one of always, never or auto (invert only bright pages)",
+		Value: montage.InvertAuto,
+	},
+	&cli.StringFlag{
+		Name:  _encoding,
+		Usage: "upload encoding, one of auto, png, png-best, gray, mono or jpeg",
+		Value: montage.EncodingAuto,
+	},
+	&cli.IntFlag{
+		Name:  _jpegQuality,
+		Usage: "JPEG quality for upload, in auto encoding it's the highest quality tried",
+		Value: 85,
+	},
+	&cli.Int64Flag{
+		Name:  _maxUpload,
+		Usage: "max bytes of uploaded image, used by auto encoding",
+		Value: montage.MaxAPIBytes,
+	},
+	&cli.StringSliceFlag{
+		Name:  _preprocess,
+		Usage: "preprocess steps applied in order before OCR: grayscale, contrast, binarize, despeckle, sharpen, crop, deskew, downscale",
+	},
+	&cli.IntFlag{
+		Name:  _targetDPI,
+		Usage: "target DPI for downscale preprocess step",
+		Value: preprocess.DefaultDPI,
+	},
+	&cli.IntFlag{
+		Name:  _sourceDPI,
+		Usage: "DPI of source images (default: read from PNG, or 300 if not available)",
+	},
+	&cli.IntFlag{
+		Name:  _maxSkew,
+		Usage: "max skew angle in degree searched by deskew preprocess step",
+		Value: preprocess.DefaultMaxSkew,
+	},
+	&cli.BoolFlag{
+		Name:    _dryRun,
+		Aliases: []string{"dr"},
+		Usage:   "show what will be done without calling API or writing anything",
+	},
+	&cli.IntFlag{
+		Name:  _retry,
+		Usage: "number of retries when OCR request failed",
+	},
+	&cli.BoolFlag{
+		Name:    _retryQuarantine,
+		Aliases: []string{"rq"},
+		Usage:   "retry OCR for pages that quarantined in previous run",
+	},
+	&cli.BoolFlag{
+		Name:    _keepGoing,
+		Aliases: []string{"k"},
+		Usage:   "keep writing outputs for successful pages when some pages failed",
+	},
+	&cli.StringFlag{
+		Name:  _logFormat,
+		Usage: "log format, either text or json",
+		Value: "text",
+	},
+	&cli.StringFlag{
+		Name:  _logLevel,
+		Usage: "log level, one of debug, info, warn or error",
+		Value: "info",
+	},
 
 	// Flags for OCR parameters
+	&cli.StringFlag{
+		Name:    _readingOrder,
+		Aliases: []string{"ro"},
+		Usage:   "paragraph reading order, one of vision, vertical, columns or xycut",
+		Value:   order.ModeVision,
+	},
 	&cli.BoolFlag{
 		Name:    _sortVertical,
 		Aliases: []string{"sv"},
-		Usage:   "sort paragraphs vertically, not work for multi column",
+		Usage:   "shortcut for --reading-order vertical",
+	},
+	&cli.StringFlag{
+		Name:  _direction,
+		Usage: "text direction for reading order and HOCR, one of auto, ltr, rtl or ttb",
+		Value: order.DirectionAuto,
+	},
+	&cli.StringFlag{
+		Name:  _language,
+		Usage: "language code used to detect text direction when Vision doesn't detect it",
 	},
 	&cli.BoolFlag{
 		Name:    _mergeNewLine,
 		Aliases: []string{"mn"},
 		Usage:   "merge newlines in a paragraph for text output",
 	},
+	&cli.BoolFlag{
+		Name:  _keepRunning,
+		Usage: "keep running headers, footers and page numbers in text output",
+	},
+	&cli.BoolFlag{
+		Name:  _document,
+		Usage: "also save text of the whole document, with paragraphs joined across pages",
+	},
+	&cli.PathFlag{
+		Name:  _dictDir,
+		Usage: "dir of word lists for dehyphenation, each named by its language code (e.g. en.txt)",
+	},
+	&cli.BoolFlag{
+		Name:  _markdown,
+		Usage: "also save the whole document as Markdown, with headings and lists inferred from layout",
+	},
+	&cli.BoolFlag{
+		Name:  _pageAnchors,
+		Usage: "mark each source page in Markdown with comment like <!-- page 12 -->",
+	},
+	&cli.BoolFlag{
+		Name:  _tables,
+		Usage: "detect tables, then save them as CSV and HTML and mark them in HOCR",
+	},
+	&cli.BoolFlag{
+		Name:  _epub,
+		Usage: "also save the whole document as EPUB, with headings as table of contents",
+	},
+	&cli.BoolFlag{
+		Name:  _epubFigures,
+		Usage: "put the pictures detected by Vision in EPUB, cropped from the source images",
+	},
+	&cli.StringFlag{
+		Name:  _title,
+		Usage: "title of the document for EPUB, default to name of the input dir",
+	},
+	&cli.StringFlag{
+		Name:  _author,
+		Usage: "author of the document for EPUB",
+	},
 
 	// Flags for text cleaner
 	&cli.BoolFlag{
@@ -6,17 +6,22 @@ import (
 	"os"
 	fp "path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/RadhiFadlillah/vision-my-pdf/internal/cleaner"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/dehyphen"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/order"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/table"
 	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
 	"github.com/go-shiori/dom"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/net/html"
 )
 
 var rxSymbolOnly = regexp.MustCompile(`^[^\p{L}\p{N}\s]+$`)
 
-func savePagesAsHOCR(tcl cleaner.Cleaner, pages []vision.Page, rootDir string) error {
+func savePagesAsHOCR(tcl cleaner.Cleaner, pages []vision.Page, pageTables map[string][]table.Table, rootDir string, report *runReport, prog *progress) error {
 	// Process each page
 	for _, page := range pages {
 		// Prepare output for this page
@@ -24,23 +29,28 @@ func savePagesAsHOCR(tcl cleaner.Cleaner, pages []vision.Page, rootDir string) e
 		textOutput := fp.Join(rootDir, imgName) + "_hocr.hocr"
 
 		// Build HOCR for this page
-		pageHOCR := pageToHOCR(tcl, page)
+		pageHOCR := pageToHOCR(tcl, page, pageTables[page.Image])
 
 		// Save text to storage
 		err := os.WriteFile(textOutput, []byte(pageHOCR), os.ModePerm)
 		if err != nil {
 			return fmt.Errorf("save HOCR failed for \"%s\": %w", imgName, err)
 		}
+
+		prog.add(1, 0)
+		report.addOutput(page.Image, textOutput)
+		logrus.WithField("page", imgName).Debug("saved HOCR")
 	}
 
 	return nil
 }
 
-func pageToHOCR(tcl cleaner.Cleaner, page vision.Page) string {
+func pageToHOCR(tcl cleaner.Cleaner, page vision.Page, tables []table.Table) string {
 	// Prepare counter
 	var paragraphCounter int
 	var lineCounter int
 	var wordCounter int
+	var tableCounter int
 
 	// Create HTML document
 	doc := dom.CreateElement("html")
@@ -65,7 +75,7 @@ func pageToHOCR(tcl cleaner.Cleaner, page vision.Page) string {
 
 	meta3 := dom.CreateElement("meta")
 	dom.SetAttribute(meta3, "name", "ocr-capabilities")
-	dom.SetAttribute(meta3, "content", "ocr_page ocr_carea ocr_par ocr_line ocrx_word")
+	dom.SetAttribute(meta3, "content", "ocr_page ocr_carea ocr_header ocr_footer ocr_pageno ocr_table ocr_par ocr_line ocrx_word")
 	dom.AppendChild(head, meta3)
 
 	// Prepare body and put it in document
@@ -80,13 +90,84 @@ func pageToHOCR(tcl cleaner.Cleaner, page vision.Page) string {
 	dom.SetAttribute(divPage, "title", rectToString(page.BoundingBox))
 	dom.AppendChild(body, divPage)
 
-	// Process each paragraph
+	// Prepare function to put table in page, with each word in its cell
+	emitted := make([]bool, len(tables))
+	emitTable := func(idx int) {
+		if emitted[idx] {
+			return
+		}
+
+		emitted[idx] = true
+		tableCounter++
+
+		t := tables[idx]
+		tableNode := dom.CreateElement("table")
+		dom.SetAttribute(tableNode, "class", "ocr_table")
+		dom.SetAttribute(tableNode, "id", fmt.Sprintf("table_1_%d", tableCounter))
+		dom.SetAttribute(tableNode, "title", rectToString(t.BoundingBox))
+		dom.AppendChild(divPage, tableNode)
+
+		for _, row := range t.Rows {
+			tr := dom.CreateElement("tr")
+			dom.AppendChild(tableNode, tr)
+
+			for _, c := range row {
+				td := dom.CreateElement("td")
+				dom.AppendChild(tr, td)
+				if len(c.Words) == 0 {
+					continue
+				}
+
+				dom.SetAttribute(td, "title", rectToString(c.BoundingBox))
+				for _, w := range c.Words {
+					wordCounter++
+					spanWord := dom.CreateElement("span")
+					dom.SetAttribute(spanWord, "class", "ocrx_word")
+					dom.SetAttribute(spanWord, "id", fmt.Sprintf("word_1_%d", wordCounter))
+					dom.SetAttribute(spanWord, "title", rectToString(w.BoundingBox))
+					dom.SetTextContent(spanWord, hocrWordText(tcl, w))
+					dom.AppendChild(td, spanWord)
+				}
+			}
+		}
+	}
+
+	// Find the table of each word that put in table cells
+	tableWords := map[image.Rectangle]int{}
+	for i, t := range tables {
+		for _, row := range t.Rows {
+			for _, c := range row {
+				for _, w := range c.Words {
+					tableWords[w.BoundingBox] = i
+				}
+			}
+		}
+	}
+
+	// Process each paragraph. Words in table cells are removed from their
+	// paragraph, and the table is put next to the first paragraph that has
+	// its words: before it if the table is above, and after it otherwise.
 	for _, p := range page.Paragraphs {
+		p, paragraphTables := removeTableWords(p, tableWords)
+
+		var tablesAfter []int
+		for _, idx := range paragraphTables {
+			if len(p.Lines) == 0 || tables[idx].BoundingBox.Min.Y <= p.BoundingBox.Min.Y {
+				emitTable(idx)
+			} else {
+				tablesAfter = append(tablesAfter, idx)
+			}
+		}
+
+		if len(p.Lines) == 0 {
+			continue
+		}
+
 		paragraphCounter++
 
 		// Create element for c-area, then put it to page
 		divCarea := dom.CreateElement("div")
-		dom.SetAttribute(divCarea, "class", "ocr_carea")
+		dom.SetAttribute(divCarea, "class", blockClass(p))
 		dom.SetAttribute(divCarea, "id", fmt.Sprintf("block_1_%d", paragraphCounter))
 		dom.SetAttribute(divCarea, "title", rectToString(p.BoundingBox))
 		dom.AppendChild(divPage, divCarea)
@@ -98,6 +179,23 @@ func pageToHOCR(tcl cleaner.Cleaner, page vision.Page) string {
 		dom.SetAttribute(pPar, "title", rectToString(p.BoundingBox))
 		dom.AppendChild(divCarea, pPar)
 
+		if p.Language != "" {
+			dom.SetAttribute(pPar, "lang", p.Language)
+		}
+
+		if p.Direction == order.DirectionRTL {
+			dom.SetAttribute(pPar, "dir", "rtl")
+		}
+
+		// Vertical line is rotated 90 degree counter clockwise from the
+		// horizontal baseline.
+		lineTitle := rectToString
+		if p.Direction == order.DirectionTTB {
+			lineTitle = func(rect image.Rectangle) string {
+				return rectToString(rect) + "; textangle 90"
+			}
+		}
+
 		// Process each line in paragraph
 		for _, l := range p.Lines {
 			lineCounter++
@@ -106,7 +204,7 @@ func pageToHOCR(tcl cleaner.Cleaner, page vision.Page) string {
 			spanLine := dom.CreateElement("span")
 			dom.SetAttribute(spanLine, "class", "ocr_line")
 			dom.SetAttribute(spanLine, "id", fmt.Sprintf("line_1_%d", lineCounter))
-			dom.SetAttribute(spanLine, "title", rectToString(l.BoundingBox))
+			dom.SetAttribute(spanLine, "title", lineTitle(l.BoundingBox))
 			dom.AppendChild(pPar, spanLine)
 
 			// Process each word in line
@@ -120,9 +218,7 @@ func pageToHOCR(tcl cleaner.Cleaner, page vision.Page) string {
 				}
 
 				// Get current word text
-				wordText := wordToText(w)
-				wordText = tcl.Clean(wordText)
-				wordText = strings.TrimSpace(wordText)
+				wordText := hocrWordText(tcl, w)
 
 				// If previous span exist, and current or previous word only
 				// contains symbol, put current word in the previous span.
@@ -152,12 +248,96 @@ func pageToHOCR(tcl cleaner.Cleaner, page vision.Page) string {
 				dom.AppendChild(spanLine, spanWord)
 			}
 		}
+
+		for _, idx := range tablesAfter {
+			emitTable(idx)
+		}
+	}
+
+	// Put the tables whose words are not found in any paragraph
+	for i := range tables {
+		emitTable(i)
 	}
 
 	// Return the final string
 	return dom.OuterHTML(doc)
 }
 
+// removeTableWords removes the words that put in table cells from paragraph,
+// then shrinks the bounds of its lines to the remaining words. Lines without
+// remaining words are dropped. It also returns the index of tables that
+// contain the removed words, in order of their first word.
+func removeTableWords(p vision.Paragraph, tableWords map[image.Rectangle]int) (vision.Paragraph, []int) {
+	if len(tableWords) == 0 {
+		return p, nil
+	}
+
+	var tableIdxs []int
+	var lines []vision.Line
+	var bounds image.Rectangle
+	for _, l := range p.Lines {
+		var words []vision.Word
+		var lineBounds image.Rectangle
+		for _, w := range l.Words {
+			idx, inTable := tableWords[w.BoundingBox]
+			if !inTable {
+				words = append(words, w)
+				lineBounds = lineBounds.Union(w.BoundingBox)
+				continue
+			}
+
+			if !slices.Contains(tableIdxs, idx) {
+				tableIdxs = append(tableIdxs, idx)
+			}
+		}
+
+		if len(words) == 0 {
+			continue
+		}
+
+		// Keep the line bounds if none of its words removed
+		if len(words) == len(l.Words) {
+			lineBounds = l.BoundingBox
+		}
+
+		lines = append(lines, vision.Line{Words: words, BoundingBox: lineBounds})
+		bounds = bounds.Union(lineBounds)
+	}
+
+	if len(tableIdxs) == 0 {
+		return p, nil
+	}
+
+	p.Lines = lines
+	p.BoundingBox = bounds
+	return p, tableIdxs
+}
+
+// hocrWordText returns the cleaned text of word. Soft hyphen marks the
+// hyphen that only used for line wrapping.
+func hocrWordText(tcl cleaner.Cleaner, w vision.Word) string {
+	wordText := wordToText(w)
+	wordText = strings.ReplaceAll(wordText, dehyphen.SoftBreak, "\u00ad")
+	wordText = strings.ReplaceAll(wordText, "↵", "")
+	wordText = tcl.Clean(wordText)
+	return strings.TrimSpace(wordText)
+}
+
+// blockClass returns the hOCR class for the block of paragraph, which marks
+// the running headers, footers and page numbers.
+func blockClass(p vision.Paragraph) string {
+	switch p.Role {
+	case vision.RoleHeader:
+		return "ocr_header"
+	case vision.RoleFooter:
+		return "ocr_footer"
+	case vision.RolePageNumber:
+		return "ocr_pageno"
+	default:
+		return "ocr_carea"
+	}
+}
+
 func rectToString(rect image.Rectangle) string {
 	return fmt.Sprintf("bbox %d %d %d %d",
 		rect.Min.X, rect.Min.Y,
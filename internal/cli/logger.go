@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+func prepareLogger(c *cli.Context) error {
+	// Parse flag for log level
+	level, err := logrus.ParseLevel(c.String(_logLevel))
+	if err != nil {
+		return fmt.Errorf("log level: %w", err)
+	}
+	logrus.SetLevel(level)
+
+	// Make sure log lines not mixed with progress line
+	if stderrIsTTY {
+		logrus.AddHook(progressHook{})
+	}
+
+	// Parse flag for log format
+	switch format := c.String(_logFormat); format {
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format \"%s\"", format)
+	}
+
+	return nil
+}
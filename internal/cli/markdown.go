@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"fmt"
+	"image"
+	"os"
+	fp "path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/classify"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/cleaner"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/dehyphen"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	rxBulletItem   = regexp.MustCompile(`^[•·▪◦●○■□►➢–*-]\s+`)
+	rxNumberItem   = regexp.MustCompile(`^(\d{1,3})[.)]\s+`)
+	rxBlockMarker  = regexp.MustCompile(`^(#|>|[-+*]\s|\d+[.)]\s)`)
+	markdownEscape = strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`,
+		`[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`)
+)
+
+func saveDocumentAsMarkdown(tcl cleaner.Cleaner, dh *dehyphen.Dehyphenator, pages []vision.Page, pageNumbers map[string]int, output string, pageAnchors bool) error {
+	docMarkdown := pagesToMarkdown(dh, pages, pageNumbers, pageAnchors)
+	docMarkdown = tcl.Clean(docMarkdown)
+
+	err := os.WriteFile(output, []byte(docMarkdown), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("save markdown failed: %w", err)
+	}
+
+	logrus.WithField("pages", len(pages)).Debugf("saved markdown to %s", fp.Base(output))
+	return nil
+}
+
+// detectEmphasis marks the strong words in page, which measured from the page
+// image. If the image can't be opened, the page is returned as it is.
+func detectEmphasis(page vision.Page) vision.Page {
+	imgName := cleanFileName(page.Image)
+	f, err := os.Open(page.Image)
+	if err != nil {
+		logrus.WithField("page", imgName).WithError(err).Warn("open image for emphasis failed")
+		return page
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		logrus.WithField("page", imgName).WithError(err).Warn("decode image for emphasis failed")
+		return page
+	}
+
+	return classify.Emphasis(page, img)
+}
+
+// pagesToMarkdown creates Markdown for the whole document. The structure is
+// taken from the paragraph roles, while the notes are put in their sections
+// at the end of document. If page anchors is enabled, each page is marked by
+// HTML comment before the paragraph where it begins, or inside the paragraph
+// where the page break falls if it's joined across pages.
+func pagesToMarkdown(dh *dehyphen.Dehyphenator, pages []vision.Page, pageNumbers map[string]int, pageAnchors bool) string {
+	// Newlines are always merged, since Markdown is reflowed anyway
+	blocks, notes := buildDocument(dh, markEmphasis(pages), pageNumbers, true)
+
+	var sb strings.Builder
+	for _, block := range blocks {
+		if pageAnchors {
+			for _, pageNumber := range block.Pages {
+				sb.WriteString(fmt.Sprintf("<!-- page %d -->\n\n", pageNumber))
+			}
+		}
+
+		if block.Text == "" {
+			continue
+		}
+
+		sb.WriteString(replacePageBreaks(blockToMarkdown(block), block.Breaks, func(pages []int) string {
+			if !pageAnchors {
+				return ""
+			}
+
+			var anchors string
+			for _, pageNumber := range pages {
+				anchors += fmt.Sprintf(" <!-- page %d -->", pageNumber)
+			}
+			return anchors
+		}))
+		sb.WriteString("\n\n")
+	}
+
+	for _, section := range noteSections {
+		var sectionNotes []docBlock
+		for _, note := range notes {
+			if note.Paragraph.Role == section.role {
+				sectionNotes = append(sectionNotes, note)
+			}
+		}
+
+		if len(sectionNotes) == 0 {
+			continue
+		}
+
+		sb.WriteString("---\n\n## " + section.title + "\n\n")
+		for _, note := range sectionNotes {
+			sb.WriteString(blockToMarkdown(note))
+			sb.WriteString("\n\n")
+		}
+	}
+
+	return sb.String()
+}
+
+func blockToMarkdown(block docBlock) string {
+	text := block.Text
+
+	switch block.Paragraph.Role {
+	case vision.RoleHeading:
+		level := min(max(block.Paragraph.Level, 1), 6)
+		text = strings.Join(strings.Fields(emphasisRemover.Replace(text)), " ")
+		return strings.Repeat("#", level) + " " + markdownEscape.Replace(text)
+
+	case vision.RoleListItem:
+		if m := rxNumberItem.FindStringSubmatch(text); m != nil {
+			return m[1] + ". " + escapeMarkdown(text[len(m[0]):])
+		}
+		if m := rxBulletItem.FindString(text); m != "" {
+			return "- " + escapeMarkdown(text[len(m):])
+		}
+		return "- " + escapeMarkdown(text)
+
+	case vision.RoleQuote:
+		lines := strings.Split(escapeMarkdown(text), "\n")
+		return "> " + strings.Join(lines, "\n> ")
+
+	case vision.RoleCaption:
+		text = emphasisRemover.Replace(text)
+		return "*" + markdownEscape.Replace(strings.Join(strings.Fields(text), " ")) + "*"
+
+	default:
+		return escapeMarkdown(text)
+	}
+}
+
+// markEmphasis copies the pages, then wraps the text of strong words with
+// the emphasis marks. The end mark is put before the hyphen of word that
+// split at the end of line, so the split word can still be joined.
+func markEmphasis(pages []vision.Page) []vision.Page {
+	marked := make([]vision.Page, len(pages))
+	for pi, page := range pages {
+		page.Paragraphs = append([]vision.Paragraph{}, page.Paragraphs...)
+		for i, p := range page.Paragraphs {
+			p.Lines = append([]vision.Line{}, p.Lines...)
+			for li, l := range p.Lines {
+				l.Words = append([]vision.Word{}, l.Words...)
+				for wi, w := range l.Words {
+					if w.Emphasis != vision.EmphasisStrong || len(w.Symbols) == 0 {
+						continue
+					}
+
+					last := len(w.Symbols) - 1
+					if last > 0 && w.Symbols[last].Text == "-" {
+						last--
+					}
+
+					w.Symbols = append([]vision.Symbol{}, w.Symbols...)
+					w.Symbols[0].Prefix = emphasisStart + w.Symbols[0].Prefix
+					w.Symbols[last].Text += emphasisEnd
+					l.Words[wi] = w
+				}
+				p.Lines[li] = l
+			}
+			page.Paragraphs[i] = p
+		}
+		marked[pi] = page
+	}
+	return marked
+}
+
+// escapeMarkdown escapes the characters that have meaning in Markdown, so
+// the text is rendered as it is. The emphasis marks are converted, with the
+// consecutive strong words merged into one emphasis.
+func escapeMarkdown(text string) string {
+	lines := strings.Split(markdownEscape.Replace(text), "\n")
+	for i, line := range lines {
+		if loc := rxBlockMarker.FindStringIndex(line); loc != nil {
+			// Escape the number by its dot, or the symbol itself
+			if marker := line[:loc[1]]; strings.ContainsAny(marker, ".)") {
+				idx := strings.IndexAny(marker, ".)")
+				lines[i] = line[:idx] + `\` + line[idx:]
+			} else {
+				lines[i] = `\` + line
+			}
+		}
+	}
+
+	text = strings.Join(lines, "\n")
+	text = strings.NewReplacer(
+		emphasisEnd+" "+emphasisStart, " ",
+		emphasisEnd+emphasisStart, "").Replace(text)
+	text = strings.NewReplacer(emphasisStart, "**", emphasisEnd, "**").Replace(text)
+	return text
+}
@@ -3,31 +3,57 @@ package cli
 import (
 	"context"
 	"fmt"
+	"path"
 	fp "path/filepath"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/RadhiFadlillah/vision-my-pdf/internal/montage"
 	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-func runOCR(montages []montage.Montage, outputDir string, nWorker int64) ([]vision.Page, error) {
+// Engines to run OCR. Image engine sends montages as images, either one by
+// one or in batch, while async engine sends them as pages of PDF file.
+const (
+	engineImage = "image"
+	engineAsync = "async"
+)
+
+type ocrOptions struct {
+	CacheDir  string
+	NWorker   int64
+	MaxRetry  int
+	KeepGoing bool
+	Montage   montage.Options
+	Encoding  montage.Encoding
+	BatchSize int
+	Engine    string
+	Async     vision.AsyncOptions
+}
+
+func runOCR(montages []montage.Montage, opts ocrOptions, report *runReport) (pages []vision.Page, failedImages []string, err error) {
 	// Prepare concurrent helper
 	var wg sync.WaitGroup
 	var mut sync.Mutex
 	ctx := context.Background()
-	sem := semaphore.NewWeighted(nWorker)
+	sem := semaphore.NewWeighted(opts.NWorker)
 
 	// Prepare output and helper functions
-	var errors []error
-	var pages []vision.Page
+	var errors []*logrus.Entry
 
-	saveError := func(err error) {
+	saveError := func(log *logrus.Entry, err error, imgPaths ...string) {
 		mut.Lock()
 		defer mut.Unlock()
-		errors = append(errors, err)
+		errors = append(errors, log.WithError(err))
+		failedImages = append(failedImages, imgPaths...)
+		for _, imgPath := range imgPaths {
+			report.setError(imgPath, err)
+		}
 	}
 
 	savePage := func(p vision.Page) {
@@ -36,21 +62,372 @@ func runOCR(montages []montage.Montage, outputDir string, nWorker int64) ([]visi
 		pages = append(pages, p)
 	}
 
-	// Run OCR concurrently
+	// Prepare progress
+	var nPages int
 	for _, montage := range montages {
-		// Prepare output for this image
-		montageName := cleanFileName(montage.Name())
-		ocrOutput := fp.Join(outputDir, montageName+".json")
+		nPages += len(montage.Paths)
+	}
+
+	prog := newProgress("ocr", nPages)
+
+	// Prepare function for failed page. Since the page already failed when
+	// OCRed alone, put it in quarantine so the next run will skip it.
+	failPage := func(log *logrus.Entry, err error, imgPath string, montageName string) {
+		log.WithError(err).Warn("ocr failed")
+		saveError(log, err, imgPath)
+		prog.add(0, 1)
+		report.setQuarantined(imgPath)
+
+		qErr := saveQuarantine(opts.CacheDir, quarantineEntry{
+			Image:   imgPath,
+			Montage: montageName,
+			Error:   err.Error(),
+			Time:    time.Now(),
+		})
+		if qErr != nil {
+			log.WithError(qErr).Warn("save quarantine failed")
+		}
+	}
+
+	// Prepare function to call the API, retry if it failed. It returns the
+	// time spent in the calls and in the backoff between them separately.
+	retry := func(log *logrus.Entry, call func() error) (*logrus.Entry, requestTiming, error) {
+		var err error
+		var timing requestTiming
+		for attempt := 0; attempt <= opts.MaxRetry; attempt++ {
+			if attempt > 0 {
+				backoff := time.Duration(attempt) * time.Second
+				time.Sleep(backoff)
+				timing.backoff += backoff
+				timing.retries = attempt
+			}
+
+			attemptStart := time.Now()
+			err = call()
+			attemptDuration := time.Since(attemptStart)
+			timing.latency += attemptDuration
+			log = log.WithFields(logrus.Fields{
+				"attempt":  attempt + 1,
+				"duration": attemptDuration.String(),
+			})
+
+			if err == nil {
+				break
+			}
+
+			if attempt < opts.MaxRetry {
+				log.WithError(err).Warn("ocr failed, retrying")
+			}
+		}
+
+		return log, timing, err
+	}
+
+	// Prepare function to save parse result to file, one cache for each page.
+	// The images without any page in result are recorded as having no text.
+	savePages := func(log *logrus.Entry, imgPaths []string, pages []vision.Page) {
+		found := map[string]bool{}
+		for _, page := range pages {
+			found[page.Image] = true
+		}
+
+		for _, imgPath := range imgPaths {
+			if !found[imgPath] {
+				log.WithField("page", cleanFileName(imgPath)).Warn("ocr found no text")
+				prog.add(1, 0)
+				report.setNoText(imgPath)
+			}
+		}
+
+		for _, page := range pages {
+			pageLog := log.WithField("page", cleanFileName(page.Image))
+			ocrOutput := fp.Join(opts.CacheDir, cleanFileName(page.Image)+".json")
+			if err := saveOcrRaw(ocrOutput, page); err != nil {
+				err = fmt.Errorf("save ocr result failed: %w", err)
+				pageLog.WithError(err).Warn("ocr failed")
+				saveError(pageLog, err, page.Image)
+				prog.add(0, 1)
+				continue
+			}
+
+			if err := removeQuarantine(opts.CacheDir, page.Image); err != nil {
+				pageLog.WithError(err).Warn("remove quarantine failed")
+			}
+
+			prog.add(1, 0)
+			savePage(page)
+			report.setPage(page)
+			pageLog.Info("converted")
+		}
+	}
+
+	// Prepare functions to OCR the montage. If OCR for the montage failed,
+	// it will be split into smaller montages until only single page left.
+	var ocrMontage func(m montage.Montage)
+	var ocrImages func(imgPaths []string, log *logrus.Entry)
+	var ocrBatch func(ms []montage.Montage)
+
+	ocrImages = func(imgPaths []string, log *logrus.Entry) {
+		// Split the images in half
+		half := (len(imgPaths) + 1) / 2
+		for _, group := range [][]string{imgPaths[:half], imgPaths[half:]} {
+			m, err := montage.Create(opts.Montage, group...)
+			if err == nil {
+				ocrMontage(m)
+				continue
+			}
+
+			// Montage can't be created, split it further
+			if len(group) > 1 {
+				ocrImages(group, log)
+				continue
+			}
+
+			err = fmt.Errorf("create montage failed: %w", err)
+			pageLog := log.WithField("page", cleanFileName(group[0]))
+			groupName := montage.Montage{Paths: group}.Name()
+			failPage(pageLog, err, group[0], cleanFileName(groupName))
+		}
+	}
+
+	ocrMontage = func(m montage.Montage) {
+		// Prepare name and logger for this montage
+		montageName := cleanFileName(m.Name())
+		report.setMontage(m.Name(), m.Paths)
+		log := logrus.WithFields(logrus.Fields{
+			"montage": montageName,
+			"pages":   cleanFileNames(m.Paths),
+		})
+
+		// Encode the montage for upload
+		payload, err := opts.Encoding.Encode(m.Image)
+		if err != nil {
+			err = fmt.Errorf("encode montage failed: %w", err)
+			log.WithError(err).Warn("ocr failed")
+			saveError(log, err, m.Paths...)
+			prog.add(0, len(m.Paths))
+			return
+		}
+
+		report.setUpload(m.Paths, len(payload.Data), payload.Format)
+		log = log.WithFields(logrus.Fields{
+			"bytes":    len(payload.Data),
+			"encoding": payload.Format,
+		})
+
+		// Packing only estimates the upload size, so make sure the encoded
+		// montage is within the limit before sending it
+		if int64(len(payload.Data)) > opts.Encoding.Limit() {
+			err = fmt.Errorf("encoded montage exceeds upload limit of %d bytes", opts.Encoding.Limit())
+			if len(m.Paths) > 1 {
+				log.WithError(err).Warn("montage too big, splitting montage")
+				ocrImages(m.Paths, log)
+				return
+			}
+
+			failPage(log.WithField("page", cleanFileName(m.Paths[0])), err, m.Paths[0], montageName)
+			return
+		}
+
+		// Parse image, retry if it failed
+		var pages []vision.Page
+		log, timing, err := retry(log, func() (err error) {
+			pages, err = vision.ParseMontage(ctx, m, payload.Data)
+			return err
+		})
+
+		report.setRequest(m.Paths, timing, err)
+		if err != nil {
+			// If the error is not caused by the pages (e.g. auth or network
+			// error), splitting the montage won't help.
+			if !isPageError(err) {
+				log.WithError(err).Warn("ocr failed")
+				saveError(log, err, m.Paths...)
+				prog.add(0, len(m.Paths))
+				return
+			}
+
+			// If there are several pages in montage, split and try again
+			if len(m.Paths) > 1 {
+				log.WithError(err).Warn("ocr failed, splitting montage")
+				ocrImages(m.Paths, log)
+				return
+			}
+
+			failPage(log.WithField("page", cleanFileName(m.Paths[0])), err, m.Paths[0], montageName)
+			return
+		}
+
+		savePages(log, m.Paths, pages)
+	}
+
+	ocrBatch = func(ms []montage.Montage) {
+		// Prepare logger for this batch
+		var batchPaths []string
+		for _, m := range ms {
+			batchPaths = append(batchPaths, m.Paths...)
+			report.setMontage(m.Name(), m.Paths)
+		}
+		log := logrus.WithField("pages", cleanFileNames(batchPaths))
+
+		// Encode the montages for upload. In async engine, all montages are
+		// put in a single PDF file.
+		var batch []montage.Montage
+		var payloads [][]byte
+		var file []byte
+
+		if opts.Engine == engineAsync {
+			payload, err := montage.EncodePDF(ms)
+			if err != nil {
+				err = fmt.Errorf("encode file failed: %w", err)
+				log.WithError(err).Warn("ocr failed")
+				saveError(log, err, batchPaths...)
+				prog.add(0, len(batchPaths))
+				return
+			}
+
+			report.setUpload(batchPaths, len(payload.Data), payload.Format)
+			batch, file = ms, payload.Data
+		} else {
+			for _, m := range ms {
+				mLog := log.WithField("montage", cleanFileName(m.Name()))
+				payload, err := opts.Encoding.Encode(m.Image)
+				if err != nil {
+					err = fmt.Errorf("encode montage failed: %w", err)
+					mLog.WithError(err).Warn("ocr failed")
+					saveError(mLog, err, m.Paths...)
+					prog.add(0, len(m.Paths))
+					continue
+				}
+
+				// Montage that too big is split and sent on its own
+				report.setUpload(m.Paths, len(payload.Data), payload.Format)
+				if int64(len(payload.Data)) > opts.Encoding.Limit() {
+					err = fmt.Errorf("encoded montage exceeds upload limit of %d bytes", opts.Encoding.Limit())
+					if len(m.Paths) > 1 {
+						mLog.WithError(err).Warn("montage too big, splitting montage")
+						ocrImages(m.Paths, mLog)
+					} else {
+						pageLog := mLog.WithField("page", cleanFileName(m.Paths[0]))
+						failPage(pageLog, err, m.Paths[0], cleanFileName(m.Name()))
+					}
+					continue
+				}
+
+				batch = append(batch, m)
+				payloads = append(payloads, payload.Data)
+			}
+		}
+
+		if len(batch) == 0 {
+			return
+		}
+
+		// Parse the whole batch, retry if it failed
+		var results []vision.BatchResult
+		log, timing, err := retry(log, func() (err error) {
+			if opts.Engine != engineAsync {
+				results, err = vision.ParseBatch(ctx, batch, payloads)
+				return err
+			}
+
+			// Each attempt uses its own directory in storage, so it won't
+			// be mixed with output of the failed attempts.
+			asyncOpts := opts.Async
+			asyncOpts.Name = path.Join(asyncOpts.Name, fmt.Sprintf("%s-%s-%d",
+				cleanFileName(batch[0].Name()),
+				cleanFileName(batch[len(batch)-1].Name()),
+				time.Now().UnixNano()))
+
+			results, err = vision.ParseFile(ctx, batch, file, asyncOpts)
+			return err
+		})
 
+		var sentPaths []string
+		for _, m := range batch {
+			sentPaths = append(sentPaths, m.Paths...)
+		}
+
+		report.setRequest(sentPaths, timing, err)
+		if err != nil {
+			// If the error is not caused by the pages, splitting won't help
+			if !isPageError(err) {
+				log.WithError(err).Warn("ocr failed")
+				saveError(log, err, sentPaths...)
+				prog.add(0, len(sentPaths))
+				return
+			}
+
+			// Whole batch rejected because of some images, so split it
+			if len(batch) > 1 {
+				log.WithError(err).Warn("ocr failed, splitting batch")
+				half := (len(batch) + 1) / 2
+				ocrBatch(batch[:half])
+				ocrBatch(batch[half:])
+				return
+			}
+
+			results = []vision.BatchResult{{Err: err}}
+		}
+
+		// Handle result of each image in batch
+		for i, result := range results {
+			m := batch[i]
+			mLog := log.WithField("montage", cleanFileName(m.Name()))
+
+			if result.Err != nil {
+				// If the image itself is rejected, split or quarantine it
+				if isPageError(result.Err) {
+					if len(m.Paths) > 1 {
+						mLog.WithError(result.Err).Warn("ocr failed, splitting montage")
+						ocrImages(m.Paths, mLog)
+					} else {
+						pageLog := mLog.WithField("page", cleanFileName(m.Paths[0]))
+						failPage(pageLog, result.Err, m.Paths[0], cleanFileName(m.Name()))
+					}
+					continue
+				}
+
+				// Else, try again with this image alone. In async engine, it's
+				// sent as its own file, so it won't be switched to image API.
+				switch {
+				case opts.Engine != engineAsync:
+					mLog.WithError(result.Err).Warn("ocr failed in batch, retrying alone")
+					ocrMontage(m)
+				case len(batch) > 1:
+					mLog.WithError(result.Err).Warn("ocr failed in batch, retrying alone")
+					ocrBatch([]montage.Montage{m})
+				default:
+					mLog.WithError(result.Err).Warn("ocr failed")
+					saveError(mLog, result.Err, m.Paths...)
+					prog.add(0, len(m.Paths))
+				}
+				continue
+			}
+
+			savePages(mLog, m.Paths, result.Pages)
+		}
+	}
+
+	// Group montages for batch request
+	batchSize := max(opts.BatchSize, 1)
+	var batches [][]montage.Montage
+	for i := 0; i < len(montages); i += batchSize {
+		batches = append(batches, montages[i:min(i+batchSize, len(montages))])
+	}
+
+	// Run OCR concurrently
+	for _, batch := range batches {
 		// Acquire semaphore
 		wg.Add(1)
 		if err := sem.Acquire(ctx, 1); err != nil {
+			prog.finish()
 			err = fmt.Errorf("ocr semaphore error: %w", err)
-			return nil, err
+			return nil, nil, err
 		}
 
 		// Run OCR
-		montage := montage
+		batch := batch
 		go func() {
 			// Make sure to release semaphore
 			defer func() {
@@ -58,44 +435,28 @@ func runOCR(montages []montage.Montage, outputDir string, nWorker int64) ([]visi
 				sem.Release(1)
 			}()
 
-			// Parse image
-			pages, err := vision.ParseMontage(ctx, montage)
-			if err != nil {
-				msg := fmt.Errorf("ocr failed for \"%s\": %w", montageName, err)
-				logrus.Warn(msg)
-				saveError(err)
-				return
-			}
-
-			if len(pages) == 0 {
-				logrus.Warnf("ocr found no text in \"%s\"", montageName)
-				return
-			}
-
-			// Save parse result to file
-			for _, page := range pages {
-				if err = saveOcrRaw(ocrOutput, page); err != nil {
-					msg := fmt.Errorf("save ocr result failed for \"%s\": %w", page.Image, err)
-					logrus.Warn(msg)
-					saveError(err)
-					return
-				}
-
-				savePage(page)
-				logrus.Printf("converted \"%s\"", page.Image)
+			if len(batch) == 1 && opts.Engine != engineAsync {
+				ocrMontage(batch[0])
+			} else {
+				ocrBatch(batch)
 			}
 		}()
 	}
 
 	// Wait until all goroutine finished
 	wg.Wait()
+	prog.finish()
 
-	// Print all error
+	// Print all error. If we are not asked to keep going, stop here.
+	sort.Strings(failedImages)
 	if nError := len(errors); nError > 0 {
-		for _, err := range errors {
-			logrus.Errorln(err)
+		for _, log := range errors {
+			log.Error("ocr failed")
+		}
+
+		if !opts.KeepGoing {
+			return nil, failedImages, fmt.Errorf("ocr fail with %d error(s)", nError)
 		}
-		return nil, fmt.Errorf("ocr fail with %d error(s)", nError)
 	}
 
 	// Sort pages by its file name
@@ -104,5 +465,14 @@ func runOCR(montages []montage.Montage, outputDir string, nWorker int64) ([]visi
 	})
 
 	logrus.Print("ocr finished")
-	return pages, nil
+	return pages, failedImages, nil
+}
+
+func isPageError(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.OutOfRange:
+		return true
+	default:
+		return false
+	}
 }
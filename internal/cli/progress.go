@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	progressTTYInterval     = 200 * time.Millisecond
+	progressSummaryInterval = 10 * time.Second
+)
+
+var (
+	stderrIsTTY    = isTerminal(os.Stderr)
+	activeProgress *progress
+	activeMut      sync.Mutex
+)
+
+type progress struct {
+	name   string
+	total  int
+	done   int
+	failed int
+	start  time.Time
+
+	mut  sync.Mutex
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newProgress(name string, total int) *progress {
+	p := &progress{
+		name:  name,
+		total: total,
+		start: time.Now(),
+		stop:  make(chan struct{}),
+	}
+
+	// Register this progress, so log lines can clear it before printed
+	activeMut.Lock()
+	activeProgress = p
+	activeMut.Unlock()
+
+	// Periodically print the progress
+	interval := progressSummaryInterval
+	if stderrIsTTY {
+		interval = progressTTYInterval
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.print()
+			}
+		}
+	}()
+
+	return p
+}
+
+func (p *progress) add(nDone, nFailed int) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.done += nDone
+	p.failed += nFailed
+}
+
+func (p *progress) finish() {
+	// Stop the printer
+	close(p.stop)
+	p.wg.Wait()
+
+	activeMut.Lock()
+	if activeProgress == p {
+		activeProgress = nil
+	}
+	activeMut.Unlock()
+
+	// Print the final state
+	p.print()
+	if stderrIsTTY {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func (p *progress) print() {
+	p.mut.Lock()
+	done, failed, total := p.done, p.failed, p.total
+	p.mut.Unlock()
+
+	// Calculate throughput and ETA
+	elapsed := time.Since(p.start)
+	processed := done + failed
+
+	var rate float64
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		rate = float64(processed) / seconds
+	}
+
+	var eta time.Duration
+	if rate > 0 && processed < total {
+		eta = time.Duration(float64(total-processed) / rate * float64(time.Second))
+		eta = eta.Round(time.Second)
+	}
+
+	// On terminal, redraw the progress line. It holds the same lock as the
+	// log hook, so a log line never clears a half-written progress line.
+	if stderrIsTTY {
+		activeMut.Lock()
+		defer activeMut.Unlock()
+		fmt.Fprintf(os.Stderr, "\r\033[K%s: %d/%d done, %d failed, %.2f/s, ETA %s",
+			p.name, done, total, failed, rate, eta)
+		return
+	}
+
+	// Else print the progress as log summary
+	logrus.WithFields(logrus.Fields{
+		"stage":  p.name,
+		"done":   done,
+		"failed": failed,
+		"total":  total,
+		"rate":   fmt.Sprintf("%.2f/s", rate),
+		"eta":    eta.String(),
+	}).Info("progress")
+}
+
+// progressHook clears the progress line on terminal, so log lines
+// are not mixed with it.
+type progressHook struct{}
+
+func (progressHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (progressHook) Fire(*logrus.Entry) error {
+	activeMut.Lock()
+	defer activeMut.Unlock()
+
+	if activeProgress != nil && stderrIsTTY {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	fs, err := f.Stat()
+	return err == nil && fs.Mode()&os.ModeCharDevice != 0
+}
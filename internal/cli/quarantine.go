@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	fp "path/filepath"
+	"time"
+)
+
+type quarantineEntry struct {
+	Image   string
+	Montage string
+	Error   string
+	Time    time.Time
+}
+
+func quarantineDir(cacheDir string) string {
+	return fp.Join(cacheDir, "quarantine")
+}
+
+func quarantinePath(cacheDir string, imgPath string) string {
+	return fp.Join(quarantineDir(cacheDir), cleanFileName(imgPath)+".json")
+}
+
+func saveQuarantine(cacheDir string, entry quarantineEntry) error {
+	dst, err := os.Create(quarantinePath(cacheDir, entry.Image))
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	encoder := json.NewEncoder(dst)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(&entry)
+}
+
+func removeQuarantine(cacheDir string, imgPath string) error {
+	err := os.Remove(quarantinePath(cacheDir, imgPath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
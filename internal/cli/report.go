@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+type runReport struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Pages      []*pageReport
+	Totals     reportTotals
+
+	mut   sync.Mutex
+	pages map[string]*pageReport
+}
+
+type pageReport struct {
+	Image          string
+	CacheHit       bool
+	Quarantined    bool     `json:",omitempty"`
+	NoText         bool     `json:",omitempty"`
+	Montage        string   `json:",omitempty"`
+	LatencyMs      int64    `json:",omitempty"`
+	BackoffMs      int64    `json:",omitempty"`
+	Retries        int      `json:",omitempty"`
+	UploadBytes    int      `json:",omitempty"`
+	Encoding       string   `json:",omitempty"`
+	Error          string   `json:",omitempty"`
+	Paragraphs     int      `json:",omitempty"`
+	Lines          int      `json:",omitempty"`
+	Words          int      `json:",omitempty"`
+	MeanConfidence float64  `json:",omitempty"`
+	Outputs        []string `json:",omitempty"`
+
+	converted bool
+}
+
+type reportTotals struct {
+	Pages       int
+	CacheHits   int
+	Converted   int
+	Failed      int
+	NoText      int
+	Quarantined int
+	Requests    int
+	Retries     int
+	UploadBytes int64
+	LatencyMs   int64
+	BackoffMs   int64
+	Paragraphs  int
+	Lines       int
+	Words       int
+	DurationMs  int64
+}
+
+func newRunReport() *runReport {
+	return &runReport{
+		StartedAt: time.Now(),
+		pages:     map[string]*pageReport{},
+	}
+}
+
+func (r *runReport) page(imgPath string) *pageReport {
+	pr, exist := r.pages[imgPath]
+	if !exist {
+		pr = &pageReport{Image: imgPath}
+		r.pages[imgPath] = pr
+	}
+	return pr
+}
+
+func (r *runReport) addCached(imgPath string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.page(imgPath).CacheHit = true
+}
+
+func (r *runReport) setMontage(montageName string, imgPaths []string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	for _, imgPath := range imgPaths {
+		r.page(imgPath).Montage = montageName
+	}
+}
+
+// requestTiming is the time spent for a request. Latency only counts the
+// API calls, while the sleep between retries is counted as backoff.
+type requestTiming struct {
+	latency time.Duration
+	backoff time.Duration
+	retries int
+}
+
+func (r *runReport) setRequest(imgPaths []string, timing requestTiming, err error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.Totals.Requests++
+	r.Totals.Retries += timing.retries
+	r.Totals.LatencyMs += timing.latency.Milliseconds()
+	r.Totals.BackoffMs += timing.backoff.Milliseconds()
+
+	for _, imgPath := range imgPaths {
+		pr := r.page(imgPath)
+		pr.LatencyMs = timing.latency.Milliseconds()
+		pr.BackoffMs = timing.backoff.Milliseconds()
+		pr.Retries = timing.retries
+		pr.Error = ""
+		if err != nil {
+			pr.Error = err.Error()
+		}
+	}
+}
+
+func (r *runReport) setUpload(imgPaths []string, nBytes int, format string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.Totals.UploadBytes += int64(nBytes)
+	for _, imgPath := range imgPaths {
+		pr := r.page(imgPath)
+		pr.UploadBytes = nBytes
+		pr.Encoding = format
+	}
+}
+
+func (r *runReport) setQuarantined(imgPath string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.page(imgPath).Quarantined = true
+}
+
+// setNoText marks the image that converted without error, but Vision found
+// no text in it, so there is no page saved for it.
+func (r *runReport) setNoText(imgPath string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	pr := r.page(imgPath)
+	pr.NoText = true
+	pr.Error = ""
+}
+
+func (r *runReport) setError(imgPath string, err error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.page(imgPath).Error = err.Error()
+}
+
+func (r *runReport) setPage(page vision.Page) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	pr := r.page(page.Image)
+	pr.converted = true
+	pr.NoText = len(page.Paragraphs) == 0
+	pr.count(page)
+}
+
+// setCachedPage counts the content of page that loaded from cache, so the
+// totals cover the whole book and not only the pages converted in this run.
+func (r *runReport) setCachedPage(page vision.Page) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.page(page.Image).count(page)
+}
+
+func (pr *pageReport) count(page vision.Page) {
+	// Count the page content
+	var nWords int
+	var nLines int
+	var sumConfidence float64
+	var nConfidence int
+
+	for _, p := range page.Paragraphs {
+		nLines += len(p.Lines)
+		for _, l := range p.Lines {
+			nWords += len(l.Words)
+			for _, w := range l.Words {
+				if w.Confidence > 0 {
+					sumConfidence += float64(w.Confidence)
+					nConfidence++
+				}
+			}
+		}
+	}
+
+	// Save it to the report
+	pr.Paragraphs = len(page.Paragraphs)
+	pr.Lines = nLines
+	pr.Words = nWords
+	pr.MeanConfidence = 0
+	if nConfidence > 0 {
+		pr.MeanConfidence = sumConfidence / float64(nConfidence)
+	}
+}
+
+func (r *runReport) addOutput(imgPath string, outputPath string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	pr := r.page(imgPath)
+	pr.Outputs = append(pr.Outputs, outputPath)
+}
+
+func (r *runReport) save(path string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	// Finalize the report
+	r.FinishedAt = time.Now()
+	r.Pages = r.Pages[:0]
+	r.Totals.Pages = len(r.pages)
+	r.Totals.CacheHits = 0
+	r.Totals.Converted = 0
+	r.Totals.Failed = 0
+	r.Totals.NoText = 0
+	r.Totals.Quarantined = 0
+	r.Totals.Paragraphs = 0
+	r.Totals.Lines = 0
+	r.Totals.Words = 0
+	r.Totals.DurationMs = r.FinishedAt.Sub(r.StartedAt).Milliseconds()
+
+	for _, pr := range r.pages {
+		r.Pages = append(r.Pages, pr)
+		r.Totals.Paragraphs += pr.Paragraphs
+		r.Totals.Lines += pr.Lines
+		r.Totals.Words += pr.Words
+
+		if pr.Quarantined {
+			r.Totals.Quarantined++
+		}
+
+		switch {
+		case pr.CacheHit:
+			r.Totals.CacheHits++
+		case pr.Error != "":
+			r.Totals.Failed++
+		case pr.NoText:
+			r.Totals.NoText++
+		case pr.converted:
+			r.Totals.Converted++
+		}
+	}
+
+	sort.Slice(r.Pages, func(a, b int) bool {
+		return r.Pages[a].Image < r.Pages[b].Image
+	})
+
+	// Save it to file
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	encoder := json.NewEncoder(dst)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	fp "path/filepath"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/cleaner"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/table"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+	"github.com/go-shiori/dom"
+	"github.com/sirupsen/logrus"
+)
+
+// detectTables reconstructs the tables in each page, keyed by page image.
+func detectTables(pages []vision.Page) map[string][]table.Table {
+	pageTables := map[string][]table.Table{}
+	for _, page := range pages {
+		if tables := table.Detect(page); len(tables) > 0 {
+			pageTables[page.Image] = tables
+		}
+	}
+	return pageTables
+}
+
+// saveTables saves each table as CSV and HTML, named after its page and its
+// position in page, e.g. "page_ocr_table_1.csv".
+func saveTables(tcl cleaner.Cleaner, pages []vision.Page, pageTables map[string][]table.Table, outputDir string, report *runReport) error {
+	for _, page := range pages {
+		imgName := cleanFileName(page.Image)
+		for i, t := range pageTables[page.Image] {
+			basePath := fp.Join(outputDir, fmt.Sprintf("%s_table_%d", imgName, i+1))
+
+			csvData, err := tableToCSV(tcl, t)
+			if err != nil {
+				return fmt.Errorf("create CSV failed for \"%s\": %w", imgName, err)
+			}
+
+			outputs := map[string][]byte{
+				basePath + ".csv":  csvData,
+				basePath + ".html": []byte(tableToHTML(tcl, t)),
+			}
+
+			for output, data := range outputs {
+				if err := os.WriteFile(output, data, os.ModePerm); err != nil {
+					return fmt.Errorf("save table failed for \"%s\": %w", imgName, err)
+				}
+				report.addOutput(page.Image, output)
+			}
+		}
+
+		if n := len(pageTables[page.Image]); n > 0 {
+			logrus.WithField("page", imgName).Debugf("saved %d table(s)", n)
+		}
+	}
+
+	return nil
+}
+
+func tableToCSV(tcl cleaner.Cleaner, t table.Table) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for _, row := range t.Rows {
+		var record []string
+		for _, c := range row {
+			record = append(record, tcl.Clean(c.Text()))
+		}
+
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func tableToHTML(tcl cleaner.Cleaner, t table.Table) string {
+	doc := dom.CreateElement("html")
+	head := dom.CreateElement("head")
+	dom.AppendChild(doc, head)
+
+	meta := dom.CreateElement("meta")
+	dom.SetAttribute(meta, "charset", "utf-8")
+	dom.AppendChild(head, meta)
+
+	body := dom.CreateElement("body")
+	dom.AppendChild(doc, body)
+
+	tableNode := dom.CreateElement("table")
+	dom.AppendChild(body, tableNode)
+
+	for _, row := range t.Rows {
+		tr := dom.CreateElement("tr")
+		dom.AppendChild(tableNode, tr)
+
+		for _, c := range row {
+			td := dom.CreateElement("td")
+			dom.SetTextContent(td, tcl.Clean(c.Text()))
+			dom.AppendChild(tr, td)
+		}
+	}
+
+	return "<!DOCTYPE html>\n" + dom.OuterHTML(doc)
+}
@@ -8,14 +8,21 @@ import (
 	"strings"
 
 	"github.com/RadhiFadlillah/vision-my-pdf/internal/cleaner"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/dehyphen"
 	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/text/unicode/bidi"
 )
 
 var rxSpaces = regexp.MustCompile(` +`)
 var rxHyphenSpace = regexp.MustCompile(`(?m)-\s*$`)
 
-func savePagesAsText(tcl cleaner.Cleaner, pages []vision.Page, rootDir string, mergeNewLine bool) error {
+type textOptions struct {
+	MergeNewLine bool
+	KeepRunning  bool
+}
+
+func savePagesAsText(tcl cleaner.Cleaner, pages []vision.Page, rootDir string, opts textOptions, report *runReport, prog *progress) error {
 	// Process each page
 	for _, page := range pages {
 		// Prepare output for this page
@@ -23,7 +30,7 @@ func savePagesAsText(tcl cleaner.Cleaner, pages []vision.Page, rootDir string, m
 		textOutput := fp.Join(rootDir, imgName) + "_hocr.txt"
 
 		// Build text for this page
-		pageText := pageToText(page, mergeNewLine)
+		pageText := pageToText(page, opts)
 		pageText = tcl.Clean(pageText)
 
 		// Save text to storage
@@ -31,17 +38,65 @@ func savePagesAsText(tcl cleaner.Cleaner, pages []vision.Page, rootDir string, m
 		if err != nil {
 			return fmt.Errorf("save text failed for \"%s\": %w", imgName, err)
 		}
+
+		prog.add(1, 0)
+		report.addOutput(page.Image, textOutput)
+		logrus.WithField("page", imgName).Debug("saved text")
 	}
 
 	return nil
 }
 
-func pageToText(page vision.Page, mergeNewLine bool) string {
+// noteSections is the sections after the main text, where the paragraphs
+// outside the main text flow are put.
+var noteSections = []struct {
+	role  string
+	title string
+}{
+	{vision.RoleFootnote, "Footnotes"},
+	{vision.RoleMarginal, "Marginal notes"},
+	{vision.RoleCaption, "Captions"},
+}
+
+func pageToText(page vision.Page, opts textOptions) string {
 	var sb strings.Builder
+	notes := map[string][]string{}
 	for _, p := range page.Paragraphs {
-		sb.WriteString(paragraphToText(p, mergeNewLine))
+		// Skip running headers, footers and page numbers
+		if isRunning(p) && !opts.KeepRunning {
+			continue
+		}
+
+		// Save notes for their own section
+		text := paragraphToText(p, opts.MergeNewLine)
+		if isNote(p) {
+			notes[p.Role] = append(notes[p.Role], text)
+			continue
+		}
+
+		sb.WriteString(text)
 		sb.WriteString("\n\n")
 	}
+
+	sb.WriteString(notesToText(notes))
+	return sb.String()
+}
+
+// notesToText puts the notes in their sections, which placed after the
+// main text.
+func notesToText(notes map[string][]string) string {
+	var sb strings.Builder
+	for _, section := range noteSections {
+		if len(notes[section.role]) == 0 {
+			continue
+		}
+
+		sb.WriteString("--- " + section.title + " ---\n\n")
+		for _, text := range notes[section.role] {
+			sb.WriteString(text)
+			sb.WriteString("\n\n")
+		}
+	}
 	return sb.String()
 }
 
@@ -69,9 +124,11 @@ func lineToText(l vision.Line, mergeNewLine bool) string {
 
 	text := sb.String()
 	if mergeNewLine {
+		text = strings.ReplaceAll(text, dehyphen.SoftBreak, "")
 		text = strings.ReplaceAll(text, "↵", "")
 		text = rxHyphenSpace.ReplaceAllString(text, "-")
 	} else {
+		text = strings.ReplaceAll(text, dehyphen.SoftBreak, "-\n")
 		text = strings.ReplaceAll(text, "-↵", "-\n")
 		text = strings.ReplaceAll(text, " ↵", "\n")
 	}
@@ -111,3 +168,21 @@ func splitMixedDirParagraph(s string) string {
 
 	return sb.String()
 }
+
+func isRunning(p vision.Paragraph) bool {
+	switch p.Role {
+	case vision.RoleHeader, vision.RoleFooter, vision.RolePageNumber:
+		return true
+	default:
+		return false
+	}
+}
+
+func isNote(p vision.Paragraph) bool {
+	switch p.Role {
+	case vision.RoleFootnote, vision.RoleMarginal, vision.RoleCaption:
+		return true
+	default:
+		return false
+	}
+}
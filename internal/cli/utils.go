@@ -3,7 +3,6 @@ package cli
 import (
 	"encoding/json"
 	"fmt"
-	"image"
 	"io"
 	"mime"
 	"os"
@@ -83,6 +82,14 @@ func cleanFileName(fName string) string {
 	return fName
 }
 
+func cleanFileNames(fNames []string) []string {
+	cleanNames := make([]string, len(fNames))
+	for i, fName := range fNames {
+		cleanNames[i] = cleanFileName(fName)
+	}
+	return cleanNames
+}
+
 func fileExist(f string) bool {
 	fs, err := os.Stat(f)
 	return err == nil && !fs.IsDir()
@@ -98,10 +105,19 @@ func saveOcrRaw(path string, page vision.Page) error {
 	return json.NewEncoder(dst).Encode(&page)
 }
 
-func getMidPoint(rect image.Rectangle) image.Point {
-	x := rect.Min.X + rect.Dx()/2
-	y := rect.Min.Y + rect.Dy()/2
-	return image.Pt(x, y)
+func groupImages(imagePaths []string, groupSize int) [][]string {
+	var groups [][]string
+	nImages := len(imagePaths)
+
+	for i := 0; i < nImages; i += groupSize {
+		limit := i + groupSize
+		if limit > nImages {
+			limit = nImages
+		}
+		groups = append(groups, imagePaths[i:limit])
+	}
+
+	return groups
 }
 
 func copyFile(srcPath string, dstDir string) error {
@@ -0,0 +1,217 @@
+package dehyphen
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	fp "path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+// Breaks at the end of line for hyphenated word. Hard break is a real
+// hyphen which kept when the line is joined, e.g. "well-known", while soft
+// break is only for line wrapping so it's removed, e.g. "contin-ued".
+const (
+	HardBreak = "-↵"
+	SoftBreak = "\u00ad↵"
+)
+
+// Dictionary is the word lists for each language, keyed by language code.
+type Dictionary map[string]map[string]struct{}
+
+// LoadDictionary loads the word lists in the dir. Each list is a text file
+// named by its language code (e.g. "en.txt"), with one word per line. Empty
+// lines and lines started with "#" are ignored.
+func LoadDictionary(dir string) (Dictionary, error) {
+	paths, err := fp.Glob(fp.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	dict := Dictionary{}
+	for _, path := range paths {
+		words, err := loadWords(path)
+		if err != nil {
+			return nil, fmt.Errorf("load word list \"%s\" failed: %w", fp.Base(path), err)
+		}
+
+		language := strings.TrimSuffix(fp.Base(path), ".txt")
+		dict[baseLanguage(language)] = words
+	}
+
+	return dict, nil
+}
+
+func loadWords(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	words := map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words[strings.ToLower(line)] = struct{}{}
+	}
+
+	return words, scanner.Err()
+}
+
+// Dehyphenator decides whether the hyphen at the end of line should be kept
+// when the line is joined with the next one. It checks the word list for the
+// paragraph language first, then the word frequencies in the document.
+type Dehyphenator struct {
+	dict  Dictionary
+	hint  string
+	freqs map[string]int
+}
+
+// New creates dehyphenator with the word frequencies counted from the pages.
+// The language hint is used for paragraph whose language is not detected.
+func New(dict Dictionary, hint string, pages []vision.Page) *Dehyphenator {
+	freqs := map[string]int{}
+	for _, page := range pages {
+		for _, p := range page.Paragraphs {
+			for _, l := range p.Lines {
+				for _, w := range l.Words {
+					if word := trimWord(w.Text()); word != "" {
+						freqs[strings.ToLower(word)]++
+					}
+				}
+			}
+		}
+	}
+
+	return &Dehyphenator{dict: dict, hint: hint, freqs: freqs}
+}
+
+// Apply marks each hyphen break between lines in the page as either hard or
+// soft break. The break at the end of paragraph is left as it is, since the
+// next part might be in the next page.
+func (d *Dehyphenator) Apply(page vision.Page) vision.Page {
+	paragraphs := make([]vision.Paragraph, len(page.Paragraphs))
+	for i, p := range page.Paragraphs {
+		lines := make([]vision.Line, len(p.Lines))
+		for j, l := range p.Lines {
+			l.Words = append([]vision.Word{}, l.Words...)
+			lines[j] = l
+		}
+
+		for j := 0; j+1 < len(lines); j++ {
+			line, next := lines[j], lines[j+1]
+			if len(line.Words) == 0 || len(next.Words) == 0 {
+				continue
+			}
+
+			last := normalizeBreak(line.Words[len(line.Words)-1])
+			if last.Suffix != HardBreak {
+				continue
+			}
+
+			if !d.KeepHyphen(p.Language, last.Text(), next.Words[0].Text()) {
+				last.Suffix = SoftBreak
+			}
+
+			line.Words[len(line.Words)-1] = last
+		}
+
+		p.Lines = lines
+		paragraphs[i] = p
+	}
+
+	page.Paragraphs = paragraphs
+	return page
+}
+
+// KeepHyphen decides whether the word that hyphenated between left and right
+// part is a compound word whose hyphen should be kept.
+func (d *Dehyphenator) KeepHyphen(language, left, right string) bool {
+	left, right = trimWord(left), trimWord(right)
+	if left == "" || right == "" {
+		return true
+	}
+
+	// Hyphen before number or proper noun is usually real, e.g. "COVID-19"
+	// or "Anglo-Saxon".
+	rightStart := []rune(right)[0]
+	properNoun := unicode.IsDigit(rightStart) || unicode.IsUpper(rightStart)
+	left, right = strings.ToLower(left), strings.ToLower(right)
+
+	joined := left + right
+	hyphenated := left + "-" + right
+
+	// Check the word list
+	if language == "" {
+		language = d.hint
+	}
+
+	words := d.dict[baseLanguage(language)]
+	if words == nil && len(d.dict) == 1 {
+		for _, w := range d.dict {
+			words = w
+		}
+	}
+
+	_, hasJoined := words[joined]
+	_, hasHyphenated := words[hyphenated]
+	if hasJoined != hasHyphenated {
+		return hasHyphenated
+	}
+
+	// Check which one is used more in the document
+	if freqJoined, freqHyphenated := d.freqs[joined], d.freqs[hyphenated]; freqJoined != freqHyphenated {
+		return freqHyphenated > freqJoined
+	}
+
+	// If both parts are known words on their own, it's likely a compound
+	_, hasLeft := words[left]
+	_, hasRight := words[right]
+	if hasLeft && hasRight && !hasJoined {
+		return true
+	}
+
+	// Otherwise assume it's only for line wrapping
+	return properNoun
+}
+
+// normalizeBreak moves the hyphen symbol at the end of line into the word
+// suffix, since Vision might return it as a symbol instead of a break.
+func normalizeBreak(w vision.Word) vision.Word {
+	if !strings.Contains(w.Suffix, "↵") || len(w.Symbols) < 2 {
+		return w
+	}
+
+	last := w.Symbols[len(w.Symbols)-1]
+	if last.Text != "-" && last.Text != "‐" {
+		return w
+	}
+
+	w.Symbols = w.Symbols[:len(w.Symbols)-1]
+	w.Suffix = HardBreak
+	return w
+}
+
+// trimWord removes the punctuations around the word, except the hyphen
+// inside it.
+func trimWord(s string) string {
+	return strings.TrimFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// baseLanguage returns the language without region, e.g. "en" for "en-US".
+func baseLanguage(language string) string {
+	language = strings.ToLower(language)
+	if idx := strings.IndexAny(language, "-_"); idx >= 0 {
+		language = language[:idx]
+	}
+	return language
+}
@@ -0,0 +1,126 @@
+package dehyphen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+// word creates a word with one symbol for each character.
+func word(text, suffix string) vision.Word {
+	var symbols []vision.Symbol
+	for _, r := range text {
+		symbols = append(symbols, vision.Symbol{Text: string(r)})
+	}
+	return vision.Word{Symbols: symbols, Suffix: suffix}
+}
+
+// textPage creates a page with a paragraph for each text, one line each.
+func textPage(texts ...string) vision.Page {
+	var page vision.Page
+	for _, text := range texts {
+		var words []vision.Word
+		for _, field := range strings.Fields(text) {
+			words = append(words, word(field, " "))
+		}
+		page.Paragraphs = append(page.Paragraphs, vision.Paragraph{
+			Lines: []vision.Line{{Words: words}},
+		})
+	}
+	return page
+}
+
+func TestKeepHyphen(t *testing.T) {
+	dict := Dictionary{
+		"en": {"well-known": {}, "continued": {}, "self": {}, "made": {}},
+		"id": {"anak-anak": {}, "berjalan": {}},
+	}
+
+	// Word frequencies in the document, used when the word list can't decide
+	doc := textPage(
+		"a data-driven approach, which data-driven teams like",
+		"as McDonald wrote",
+	)
+	dh := New(dict, "id", []vision.Page{doc})
+
+	tests := []struct {
+		name     string
+		language string
+		left     string
+		right    string
+		want     bool
+	}{
+		{"compound in word list", "en", "well", "known", true},
+		{"soft hyphen in word list", "en", "contin", "ued", false},
+		{"word list of region", "en-US", "contin", "ued.", false},
+		{"punctuation around word", "en", "(well", "known),", true},
+		{"compound in document", "en", "data", "driven", true},
+		{"soft hyphen in document", "en", "Mc", "Donald", false},
+		{"both parts are words", "en", "self", "made", true},
+		{"dictionary miss", "en", "frob", "nicate", false},
+		{"dictionary miss before number", "en", "COVID", "19", true},
+		{"dictionary miss before proper noun", "en", "Anglo", "Saxon", true},
+		{"language from hint", "", "anak", "anak", true},
+		{"language from hint soft", "", "ber", "jalan", false},
+		{"empty part", "en", "-", "known", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dh.KeepHyphen(tt.language, tt.left, tt.right); got != tt.want {
+				t.Errorf("KeepHyphen(%q, %q, %q) = %v, want %v", tt.language, tt.left, tt.right, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepHyphenSingleDictionary(t *testing.T) {
+	// If there is only one word list, it's used for unknown language
+	dh := New(Dictionary{"en": {"continued": {}}}, "", nil)
+	if dh.KeepHyphen("fr", "contin", "ued") {
+		t.Errorf("want soft hyphen from the only word list")
+	}
+}
+
+func TestApply(t *testing.T) {
+	dict := Dictionary{"en": {"well-known": {}, "continued": {}}}
+	dh := New(dict, "en", nil)
+
+	page := vision.Page{Paragraphs: []vision.Paragraph{{
+		Language: "en",
+		Lines: []vision.Line{
+			{Words: []vision.Word{word("it", " "), word("was", " "), word("contin-", "↵")}},
+			{Words: []vision.Word{word("ued", " "), word("a", " "), word("well", "-↵")}},
+			{Words: []vision.Word{word("known", " "), word("and", " "), word("contin-", "↵")}},
+		},
+	}}}
+
+	got := dh.Apply(page)
+	lines := got.Paragraphs[0].Lines
+
+	tests := []struct {
+		name       string
+		word       vision.Word
+		wantText   string
+		wantSuffix string
+	}{
+		{"soft hyphen", lines[0].Words[2], "contin", SoftBreak},
+		{"compound", lines[1].Words[2], "well", HardBreak},
+		{"end of paragraph", lines[2].Words[2], "contin-", "↵"},
+	}
+
+	for _, tt := range tests {
+		if text := tt.word.Text(); text != tt.wantText {
+			t.Errorf("%s: got text %q, want %q", tt.name, text, tt.wantText)
+		}
+		if tt.word.Suffix != tt.wantSuffix {
+			t.Errorf("%s: got suffix %q, want %q", tt.name, tt.word.Suffix, tt.wantSuffix)
+		}
+	}
+
+	// The input page is not modified
+	if suffix := page.Paragraphs[0].Lines[0].Words[2].Suffix; suffix != "↵" {
+		t.Errorf("input page is modified, got suffix %q", suffix)
+	}
+}
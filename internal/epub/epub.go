@@ -0,0 +1,252 @@
+package epub
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// Metadata is the book metadata, which put in the package document.
+type Metadata struct {
+	Identifier string
+	Title      string
+	Author     string
+	Language   string
+	Modified   time.Time
+}
+
+// Document is a content document in the book. Body is the XHTML content
+// inside the body element.
+type Document struct {
+	Name  string
+	Title string
+	Body  string
+}
+
+// Heading is an entry in the table of contents, which points to element
+// with the specified ID in a document.
+type Heading struct {
+	Document string
+	ID       string
+	Title    string
+	Level    int
+}
+
+// PageMarker is an entry in the page list, which points to the page break
+// element of a source page.
+type PageMarker struct {
+	Document string
+	ID       string
+	Label    string
+}
+
+// Image is an image file in the book, referenced by its name from the
+// documents, e.g. "images/figure-1.png".
+type Image struct {
+	Name      string
+	MediaType string
+	Data      []byte
+}
+
+// Book is a reflowable EPUB 3 book.
+type Book struct {
+	Metadata  Metadata
+	Documents []Document
+	Headings  []Heading
+	Pages     []PageMarker
+	Images    []Image
+}
+
+const stylesheet = `body { margin: 0 5%; line-height: 1.4; }
+h1, h2, h3, h4, h5, h6 { text-align: center; }
+blockquote { margin: 1em 2em; }
+figure { margin: 1em 0; text-align: center; }
+figure img { max-width: 100%; }
+figcaption { font-style: italic; }
+`
+
+// Write writes the book as EPUB file. The mimetype must be the first entry
+// and stored without compression.
+func (b Book) Write(w io.Writer) error {
+	if len(b.Documents) == 0 {
+		return fmt.Errorf("book has no document")
+	}
+
+	zw := zip.NewWriter(w)
+	mimetype, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"META-INF/container.xml", []byte(containerXML)},
+		{"OEBPS/content.opf", []byte(b.packageDocument())},
+		{"OEBPS/nav.xhtml", []byte(b.navDocument())},
+		{"OEBPS/style.css", []byte(stylesheet)},
+	}
+
+	for _, doc := range b.Documents {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{"OEBPS/" + doc.Name, []byte(xhtmlDocument(doc.Title, b.Metadata.Language, doc.Body))})
+	}
+
+	for _, img := range b.Images {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{"OEBPS/" + img.Name, img.Data})
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+
+		if _, err = fw.Write(f.data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+func (b Book) packageDocument() string {
+	meta := b.Metadata
+	esc := html.EscapeString
+
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	sb.WriteString(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">` + "\n")
+
+	// Metadata
+	sb.WriteString(`  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` + "\n")
+	sb.WriteString(fmt.Sprintf("    <dc:identifier id=\"book-id\">%s</dc:identifier>\n", esc(meta.Identifier)))
+	sb.WriteString(fmt.Sprintf("    <dc:title>%s</dc:title>\n", esc(meta.Title)))
+	sb.WriteString(fmt.Sprintf("    <dc:language>%s</dc:language>\n", esc(meta.Language)))
+	if meta.Author != "" {
+		sb.WriteString(fmt.Sprintf("    <dc:creator>%s</dc:creator>\n", esc(meta.Author)))
+	}
+	sb.WriteString(fmt.Sprintf("    <meta property=\"dcterms:modified\">%s</meta>\n",
+		meta.Modified.UTC().Format("2006-01-02T15:04:05Z")))
+	sb.WriteString("  </metadata>\n")
+
+	// Manifest
+	sb.WriteString("  <manifest>\n")
+	sb.WriteString(`    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>` + "\n")
+	sb.WriteString(`    <item id="style" href="style.css" media-type="text/css"/>` + "\n")
+	for i, doc := range b.Documents {
+		sb.WriteString(fmt.Sprintf("    <item id=\"doc-%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n",
+			i+1, esc(doc.Name)))
+	}
+	for i, img := range b.Images {
+		sb.WriteString(fmt.Sprintf("    <item id=\"img-%d\" href=\"%s\" media-type=\"%s\"/>\n",
+			i+1, esc(img.Name), esc(img.MediaType)))
+	}
+	sb.WriteString("  </manifest>\n")
+
+	// Spine
+	sb.WriteString("  <spine>\n")
+	for i := range b.Documents {
+		sb.WriteString(fmt.Sprintf("    <itemref idref=\"doc-%d\"/>\n", i+1))
+	}
+	sb.WriteString("  </spine>\n")
+	sb.WriteString("</package>\n")
+
+	return sb.String()
+}
+
+// navDocument creates the navigation document, which contains the table of
+// contents from headings and the page list.
+func (b Book) navDocument() string {
+	esc := html.EscapeString
+
+	var sb strings.Builder
+	sb.WriteString(`<nav epub:type="toc" id="toc">` + "\n")
+	sb.WriteString("<h1>Contents</h1>\n")
+
+	// Headings are nested by their level. If there are no headings, point
+	// to the first document so the TOC is not empty.
+	headings := b.Headings
+	if len(headings) == 0 {
+		headings = []Heading{{Document: b.Documents[0].Name, Title: b.Metadata.Title, Level: 1}}
+	}
+
+	var levels []int
+	for _, h := range headings {
+		// Close the deeper lists, then open the list for this level. The
+		// outermost list is never closed, since TOC must have only one list.
+		for len(levels) > 1 && levels[len(levels)-1] > h.Level {
+			sb.WriteString("</li>\n</ol>\n")
+			levels = levels[:len(levels)-1]
+		}
+
+		if len(levels) == 0 || levels[len(levels)-1] < h.Level {
+			sb.WriteString("<ol>\n")
+			levels = append(levels, h.Level)
+		} else {
+			sb.WriteString("</li>\n")
+		}
+
+		href := h.Document
+		if h.ID != "" {
+			href += "#" + h.ID
+		}
+		sb.WriteString(fmt.Sprintf("<li><a href=\"%s\">%s</a>", esc(href), esc(h.Title)))
+	}
+
+	for range levels {
+		sb.WriteString("</li>\n</ol>\n")
+	}
+	sb.WriteString("</nav>\n")
+
+	// Page list
+	if len(b.Pages) > 0 {
+		sb.WriteString(`<nav epub:type="page-list" id="page-list" hidden="hidden">` + "\n")
+		sb.WriteString("<h1>Pages</h1>\n<ol>\n")
+		for _, p := range b.Pages {
+			sb.WriteString(fmt.Sprintf("<li><a href=\"%s#%s\">%s</a></li>\n",
+				esc(p.Document), esc(p.ID), esc(p.Label)))
+		}
+		sb.WriteString("</ol>\n</nav>\n")
+	}
+
+	return xhtmlDocument(b.Metadata.Title, b.Metadata.Language, sb.String())
+}
+
+func xhtmlDocument(title, language, body string) string {
+	esc := html.EscapeString
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` +
+		esc(language) + `" lang="` + esc(language) + `">
+<head>
+<meta charset="utf-8"/>
+<title>` + esc(title) + `</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+` + body + `</body>
+</html>
+`
+}
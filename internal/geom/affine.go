@@ -0,0 +1,81 @@
+package geom
+
+import (
+	"image"
+	"math"
+)
+
+// Affine is a 2D affine transform, where a point (x, y) is transformed into
+// (A*x + B*y + C, D*x + E*y + F).
+type Affine struct {
+	A, B, C float64
+	D, E, F float64
+}
+
+func Identity() Affine {
+	return Affine{A: 1, E: 1}
+}
+
+func Translate(dx, dy float64) Affine {
+	return Affine{A: 1, C: dx, E: 1, F: dy}
+}
+
+func Scale(sx, sy float64) Affine {
+	return Affine{A: sx, E: sy}
+}
+
+// Rotate returns transform that rotates a point clockwise (in image coordinate
+// where Y axis points down) by the specified degree around the pivot.
+func Rotate(degree float64, pivotX, pivotY float64) Affine {
+	rad := degree * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	rotation := Affine{A: cos, B: -sin, D: sin, E: cos}
+	return Translate(pivotX, pivotY).Then(rotation.Then(Translate(-pivotX, -pivotY)))
+}
+
+// Then returns transform that applies `next` first, then `a`.
+func (a Affine) Then(next Affine) Affine {
+	return Affine{
+		A: a.A*next.A + a.B*next.D,
+		B: a.A*next.B + a.B*next.E,
+		C: a.A*next.C + a.B*next.F + a.C,
+		D: a.D*next.A + a.E*next.D,
+		E: a.D*next.B + a.E*next.E,
+		F: a.D*next.C + a.E*next.F + a.F,
+	}
+}
+
+func (a Affine) IsZero() bool {
+	return a == Affine{}
+}
+
+func (a Affine) IsIdentity() bool {
+	return a == Identity()
+}
+
+func (a Affine) Apply(x, y float64) (float64, float64) {
+	return a.A*x + a.B*y + a.C, a.D*x + a.E*y + a.F
+}
+
+// Rect transforms the rectangle, then returns the bounding box of the
+// transformed corners.
+func (a Affine) Rect(rect image.Rectangle) image.Rectangle {
+	corners := [][2]float64{
+		{float64(rect.Min.X), float64(rect.Min.Y)},
+		{float64(rect.Max.X), float64(rect.Min.Y)},
+		{float64(rect.Max.X), float64(rect.Max.Y)},
+		{float64(rect.Min.X), float64(rect.Max.Y)},
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, corner := range corners {
+		x, y := a.Apply(corner[0], corner[1])
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+
+	return image.Rect(
+		int(math.Round(minX)), int(math.Round(minY)),
+		int(math.Round(maxX)), int(math.Round(maxY)))
+}
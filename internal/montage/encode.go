@@ -0,0 +1,187 @@
+package montage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/pdf"
+)
+
+const (
+	EncodingAuto    = "auto"
+	EncodingPNG     = "png"
+	EncodingPNGBest = "png-best"
+	EncodingGray    = "gray"
+	EncodingMono    = "mono"
+	EncodingJPEG    = "jpeg"
+)
+
+// Encoding specifies how montage image is encoded before uploaded. In auto
+// mode, the encodings are tried from the best quality until the result is
+// not bigger than MaxBytes.
+type Encoding struct {
+	Mode        string
+	JPEGQuality int
+	MaxBytes    int64
+}
+
+// Payload is the encoded montage image.
+type Payload struct {
+	Data   []byte
+	Format string
+}
+
+func (e Encoding) Validate() error {
+	switch e.Mode {
+	case EncodingAuto, EncodingPNG, EncodingPNGBest, EncodingGray, EncodingMono, EncodingJPEG:
+	default:
+		return fmt.Errorf("unknown encoding \"%s\"", e.Mode)
+	}
+
+	if e.JPEGQuality < 1 || e.JPEGQuality > 100 {
+		return fmt.Errorf("jpeg quality must be between 1 and 100")
+	}
+
+	return nil
+}
+
+// Limit returns the max size of encoded image, which never exceeds the API
+// limit.
+func (e Encoding) Limit() int64 {
+	if e.MaxBytes <= 0 || e.MaxBytes > MaxAPIBytes {
+		return MaxAPIBytes
+	}
+	return e.MaxBytes
+}
+
+func (e Encoding) Encode(img image.Image) (Payload, error) {
+	if e.Mode != EncodingAuto {
+		return encode(img, e.Mode, e.JPEGQuality)
+	}
+
+	maxBytes := e.Limit()
+
+	// Try lossless encodings first, then lower the JPEG quality
+	type candidate struct {
+		format  string
+		quality int
+	}
+
+	candidates := []candidate{{EncodingPNGBest, 0}, {EncodingGray, 0}}
+	for quality := e.JPEGQuality; quality >= 30; quality -= 15 {
+		candidates = append(candidates, candidate{EncodingJPEG, quality})
+	}
+	candidates = append(candidates, candidate{EncodingMono, 0})
+
+	// Use the first one that fits, or the smallest if none of them fits
+	var smallest Payload
+	for _, c := range candidates {
+		payload, err := encode(img, c.format, c.quality)
+		if err != nil {
+			return Payload{}, err
+		}
+
+		if int64(len(payload.Data)) <= maxBytes {
+			return payload, nil
+		}
+
+		if smallest.Data == nil || len(payload.Data) < len(smallest.Data) {
+			smallest = payload
+		}
+	}
+
+	return smallest, nil
+}
+
+// EncodePDF puts each montage as a page in PDF file, which used for async
+// OCR. Page size is calculated from image size in 300 DPI, but it doesn't
+// really matter since Vision returns coordinates relative to the page size.
+func EncodePDF(montages []Montage) (Payload, error) {
+	if len(montages) == 0 {
+		return Payload{}, fmt.Errorf("no montage to encode")
+	}
+
+	const mmPerPixel = 25.4 / 300
+	pageSize := func(img image.Image) (float64, float64) {
+		size := img.Bounds().Size()
+		return float64(size.X) * mmPerPixel, float64(size.Y) * mmPerPixel
+	}
+
+	var buf bytes.Buffer
+	width, height := pageSize(montages[0].Image)
+	doc := pdf.New(&buf, width, height, nil)
+
+	for i, m := range montages {
+		if i > 0 {
+			width, height = pageSize(m.Image)
+			doc.NewPage(width, height)
+		}
+
+		doc.RenderImage(m.Image, canvas.Identity.Scale(mmPerPixel, mmPerPixel))
+	}
+
+	if err := doc.Close(); err != nil {
+		return Payload{}, err
+	}
+
+	return Payload{Data: buf.Bytes(), Format: "pdf"}, nil
+}
+
+func encode(img image.Image, format string, jpegQuality int) (Payload, error) {
+	var err error
+	var buf bytes.Buffer
+
+	switch format {
+	case EncodingPNGBest:
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, img)
+	case EncodingGray:
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, toGray(img))
+	case EncodingMono:
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, toMono(img))
+	case EncodingJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		format = fmt.Sprintf("%s-%d", format, jpegQuality)
+	default:
+		err = png.Encode(&buf, img)
+	}
+
+	if err != nil {
+		return Payload{}, err
+	}
+
+	return Payload{Data: buf.Bytes(), Format: format}, nil
+}
+
+func toGray(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(bounds)
+	draw.Draw(gray, bounds, img, bounds.Min, draw.Src)
+	return gray
+}
+
+// toMono converts the image into 1-bit image. PNG encoder will use 1-bit
+// depth for palette with only two colors.
+func toMono(img image.Image) *image.Paletted {
+	gray := toGray(img)
+	bounds := gray.Bounds()
+	mono := image.NewPaletted(bounds, color.Palette{color.Black, color.White})
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			if gray.Pix[y*gray.Stride+x] >= 128 {
+				mono.Pix[y*mono.Stride+x] = 1
+			}
+		}
+	}
+
+	return mono
+}
@@ -0,0 +1,59 @@
+package montage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+const (
+	InvertAlways = "always"
+	InvertNever  = "never"
+	InvertAuto   = "auto"
+)
+
+func validateInvert(mode string) error {
+	switch mode {
+	case InvertAlways, InvertNever, InvertAuto:
+		return nil
+	default:
+		return fmt.Errorf("unknown invert mode \"%s\"", mode)
+	}
+}
+
+// shouldInvert decides whether the image should be inverted. Google vision
+// seems to yield better performance with white text on black background, so
+// in auto mode only bright pages (which likely dark text on white paper) are
+// inverted, while pages that already dark are kept as it is.
+func shouldInvert(mode string, img image.Image) bool {
+	switch mode {
+	case InvertAlways:
+		return true
+	case InvertNever:
+		return false
+	default:
+		return MeanLuminance(img) >= 128
+	}
+}
+
+// MeanLuminance returns the average luminance of the image. To make it fast,
+// only some of the pixels are sampled.
+func MeanLuminance(img image.Image) float64 {
+	bounds := img.Bounds()
+	step := max(1, min(bounds.Dx(), bounds.Dy())/200)
+
+	var sum, count float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			sum += float64(gray.Y)
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	return sum / count
+}
@@ -0,0 +1,134 @@
+package montage
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	LayoutVertical   = "vertical"
+	LayoutHorizontal = "horizontal"
+	LayoutGrid       = "grid"
+)
+
+type Layout struct {
+	Mode      string
+	Columns   int
+	Gutter    int
+	Separator int
+}
+
+func (l Layout) Validate() error {
+	switch l.Mode {
+	case LayoutVertical, LayoutHorizontal, LayoutGrid:
+	default:
+		return fmt.Errorf("unknown montage layout \"%s\"", l.Mode)
+	}
+
+	if l.Gutter < 0 || l.Separator < 0 || l.Columns < 0 {
+		return fmt.Errorf("montage gutter, separator and columns must not be negative")
+	}
+
+	if l.Separator > l.Gutter {
+		return fmt.Errorf("montage separator must not be thicker than gutter")
+	}
+
+	return nil
+}
+
+// arrange returns the canvas size and the area of each tile in canvas.
+func (l Layout) arrange(sizes []image.Point) (image.Point, []image.Rectangle) {
+	// Determine number of columns and rows
+	nTiles := len(sizes)
+	if nTiles == 0 {
+		return image.Point{}, nil
+	}
+
+	var nCols int
+	switch l.Mode {
+	case LayoutHorizontal:
+		nCols = nTiles
+	case LayoutGrid:
+		nCols = l.Columns
+		if nCols <= 0 {
+			nCols = int(math.Ceil(math.Sqrt(float64(nTiles))))
+		}
+		if nCols > nTiles {
+			nCols = nTiles
+		}
+	default:
+		nCols = 1
+	}
+	nRows := (nTiles + nCols - 1) / nCols
+
+	// Calculate size of each column and row
+	colWidths := make([]int, nCols)
+	rowHeights := make([]int, nRows)
+	for i, size := range sizes {
+		col, row := i%nCols, i/nCols
+		if size.X > colWidths[col] {
+			colWidths[col] = size.X
+		}
+		if size.Y > rowHeights[row] {
+			rowHeights[row] = size.Y
+		}
+	}
+
+	// Calculate offset of each column and row
+	colOffsets := make([]int, nCols)
+	rowOffsets := make([]int, nRows)
+	for col := 1; col < nCols; col++ {
+		colOffsets[col] = colOffsets[col-1] + colWidths[col-1] + l.Gutter
+	}
+	for row := 1; row < nRows; row++ {
+		rowOffsets[row] = rowOffsets[row-1] + rowHeights[row-1] + l.Gutter
+	}
+
+	// Put each tile in its cell
+	rects := make([]image.Rectangle, nTiles)
+	for i, size := range sizes {
+		col, row := i%nCols, i/nCols
+		min := image.Pt(colOffsets[col], rowOffsets[row])
+		rects[i] = image.Rectangle{Min: min, Max: min.Add(size)}
+	}
+
+	canvas := image.Pt(
+		colOffsets[nCols-1]+colWidths[nCols-1],
+		rowOffsets[nRows-1]+rowHeights[nRows-1])
+	return canvas, rects
+}
+
+// separators returns the area of separator bars, placed in the middle of
+// gutters between tiles.
+func (l Layout) separators(canvas image.Point, rects []image.Rectangle) []image.Rectangle {
+	if l.Separator <= 0 || l.Gutter <= 0 {
+		return nil
+	}
+
+	// Collect the start of each column and row, except the first one
+	xStarts := map[int]struct{}{}
+	yStarts := map[int]struct{}{}
+	for _, rect := range rects {
+		if rect.Min.X > 0 {
+			xStarts[rect.Min.X] = struct{}{}
+		}
+		if rect.Min.Y > 0 {
+			yStarts[rect.Min.Y] = struct{}{}
+		}
+	}
+
+	// Create bar in the middle of gutter before each start
+	var bars []image.Rectangle
+	offset := (l.Gutter - l.Separator) / 2
+	for x := range xStarts {
+		x0 := x - l.Gutter + offset
+		bars = append(bars, image.Rect(x0, 0, x0+l.Separator, canvas.Y))
+	}
+	for y := range yStarts {
+		y0 := y - l.Gutter + offset
+		bars = append(bars, image.Rect(0, y0, canvas.X, y0+l.Separator))
+	}
+
+	return bars
+}
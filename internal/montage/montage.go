@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/geom"
 	"github.com/anthonynsimon/bild/effect"
 	"github.com/anthonynsimon/bild/imgio"
 )
@@ -14,83 +15,136 @@ type Montage struct {
 	Image  image.Image
 	Paths  []string
 	Bounds []image.Rectangle
+
+	// Transforms map coordinates inside each tile back to its source image,
+	// and SourceBounds are the bounds of each source image. They only differ
+	// from the tile when loader modifies the image, e.g. cropped or scaled.
+	Transforms   []geom.Affine
+	SourceBounds []image.Rectangle
+
+	// Inverted reports whether each tile is inverted in the montage.
+	Inverted []bool
+}
+
+// Options specifies how montage is created.
+type Options struct {
+	Layout Layout
+	Loader Loader
+	Invert string
+}
+
+func (o Options) Validate() error {
+	if err := o.Layout.Validate(); err != nil {
+		return err
+	}
+	return validateInvert(o.Invert)
+}
+
+// Source is an image that will be put in montage.
+type Source struct {
+	Image     image.Image
+	Bounds    image.Rectangle
+	Transform geom.Affine
 }
 
-func Create(imagePaths ...string) (Montage, error) {
+// Loader opens the image in the specified path. Beside the image, it also
+// returns the bounds of original image and the transform to map coordinates
+// in the loaded image back to the original image.
+type Loader func(path string) (Source, error)
+
+func OpenSource(path string) (Source, error) {
+	img, err := imgio.Open(path)
+	if err != nil {
+		return Source{}, err
+	}
+
+	return Source{
+		Image:     img,
+		Bounds:    img.Bounds(),
+		Transform: geom.Identity(),
+	}, nil
+}
+
+func Create(opts Options, imagePaths ...string) (Montage, error) {
 	// Prepare variables
 	var empty Montage
+	loader := opts.Loader
+	if loader == nil {
+		loader = OpenSource
+	}
 
 	// Convert image paths so it's standalone
 	imagePaths = append([]string{}, imagePaths...)
 
-	// If there is only one image, use it as it is
-	if len(imagePaths) == 1 {
-		img, err := imgio.Open(imagePaths[0])
-		if err != nil {
-			return empty, err
-		}
-		imgRect := img.Bounds()
-
-		return Montage{
-			Image:  img,
-			Paths:  []string{imagePaths[0]},
-			Bounds: []image.Rectangle{imgRect},
-		}, nil
-	}
-
-	// Open and calculate each image bound
-	var maxWidth int
-	var totalHeight int
+	// Open and calculate each image size
 	images := make([]image.Image, len(imagePaths))
+	sizes := make([]image.Point, len(imagePaths))
+	transforms := make([]geom.Affine, len(imagePaths))
+	sourceBounds := make([]image.Rectangle, len(imagePaths))
+	inverted := make([]bool, len(imagePaths))
 
+	var nInverted int
 	for i, imgPath := range imagePaths {
 		// Open the image
-		img, err := imgio.Open(imgPath)
+		src, err := loader(imgPath)
 		if err != nil {
 			return empty, err
 		}
-		images[i] = img
 
-		// Get the image bounds
-		rect := img.Bounds()
-		totalHeight += rect.Dy()
-		if width := rect.Dx(); width > maxWidth {
-			maxWidth = width
+		images[i] = src.Image
+		sizes[i] = src.Image.Bounds().Size()
+		transforms[i] = src.Transform
+		sourceBounds[i] = src.Bounds
+
+		// Invert image if needed
+		if shouldInvert(opts.Invert, src.Image) {
+			images[i] = effect.Invert(src.Image)
+			inverted[i] = true
+			nInverted++
 		}
 	}
 
-	// Create an empty canvas
-	canvas := image.NewRGBA(image.Rect(0, 0, maxWidth, totalHeight))
-	draw.Draw(canvas, canvas.Rect, image.White, image.Pt(0, 0), draw.Over)
+	// If there is only one image, use it as it is
+	if len(images) == 1 {
+		return Montage{
+			Image:        images[0],
+			Paths:        imagePaths,
+			Bounds:       []image.Rectangle{images[0].Bounds()},
+			Transforms:   transforms,
+			SourceBounds: sourceBounds,
+			Inverted:     inverted,
+		}, nil
+	}
+
+	// Arrange the images, then create an empty canvas. The background
+	// follows the majority of tiles, so it's black when most tiles inverted.
+	background, foreground := image.White, image.Black
+	if nInverted*2 >= len(images) {
+		background, foreground = image.Black, image.White
+	}
+
+	canvasSize, imageBounds := opts.Layout.arrange(sizes)
+	canvas := image.NewRGBA(image.Rectangle{Max: canvasSize})
+	draw.Draw(canvas, canvas.Rect, background, image.Pt(0, 0), draw.Src)
 
 	// Put each image in the canvas
-	var yOffset int
-	var imageBounds []image.Rectangle
-	for _, img := range images {
-		// Get the image bound
-		imgRect := img.Bounds()
-		imgWidth, imgHeight := imgRect.Dx(), imgRect.Dy()
-
-		// Draw the image
-		drawArea := image.Rect(0, yOffset, imgWidth, yOffset+imgHeight)
-		draw.Draw(canvas, drawArea, img, img.Bounds().Min, draw.Over)
-
-		// Increase the Y offset
-		yOffset += imgHeight
-
-		// Save the boundaries
-		imageBounds = append(imageBounds, drawArea)
+	for i, img := range images {
+		draw.Draw(canvas, imageBounds[i], img, img.Bounds().Min, draw.Over)
 	}
 
-	// Invert image, since Google vision seems to yield better performance
-	// with white text on black background.
-	canvas = effect.Invert(canvas)
+	// Draw separator between images
+	for _, bar := range opts.Layout.separators(canvasSize, imageBounds) {
+		draw.Draw(canvas, bar, foreground, image.Pt(0, 0), draw.Src)
+	}
 
 	// Return the montage
 	return Montage{
-		Image:  canvas,
-		Paths:  imagePaths,
-		Bounds: imageBounds,
+		Image:        canvas,
+		Paths:        imagePaths,
+		Bounds:       imageBounds,
+		Transforms:   transforms,
+		SourceBounds: sourceBounds,
+		Inverted:     inverted,
 	}, nil
 }
 
@@ -0,0 +1,130 @@
+package montage
+
+import (
+	"fmt"
+	"image"
+	"os"
+)
+
+// Limits of Google Vision API. The request is limited to 10 MB of JSON
+// where the image is base64 encoded, so the raw image must be smaller.
+const (
+	MaxAPIPixels = 75_000_000
+	MaxAPIBytes  = 7_500_000
+)
+
+// Default limits of the montage shape. Vision downsamples image that too long
+// or too narrow, which loses the accuracy that montage packing tries to keep.
+const (
+	DefaultMaxPages    = 5
+	DefaultMaxLongEdge = 10_000
+	DefaultMaxAspect   = 4.0
+)
+
+// Budget is the limits of each packed montage. MaxLongEdge is the max length
+// of the longer side, while MaxAspect is the max ratio of the longer side to
+// the shorter side.
+//
+// MaxBytes is checked against the size of image files, which is only an
+// estimate of the encoded montage, so the encoded size must be checked again
+// before upload. If Loader is specified, the image size is taken from the
+// loaded image (e.g. after preprocessed) instead of the image file.
+type Budget struct {
+	MaxPixels   int
+	MaxBytes    int64
+	MaxPages    int
+	MaxLongEdge int
+	MaxAspect   float64
+	Loader      Loader
+}
+
+func Pack(budget Budget, layout Layout, imagePaths ...string) ([][]string, error) {
+	// Make sure budget doesn't exceed the API limits
+	if budget.MaxPixels <= 0 || budget.MaxPixels > MaxAPIPixels {
+		budget.MaxPixels = MaxAPIPixels
+	}
+
+	if budget.MaxBytes <= 0 || budget.MaxBytes > MaxAPIBytes {
+		budget.MaxBytes = MaxAPIBytes
+	}
+
+	if budget.MaxPages <= 0 {
+		budget.MaxPages = DefaultMaxPages
+	}
+
+	if budget.MaxLongEdge <= 0 {
+		budget.MaxLongEdge = DefaultMaxLongEdge
+	}
+
+	if budget.MaxAspect < 1 {
+		budget.MaxAspect = DefaultMaxAspect
+	}
+
+	// Group consecutive images until the budget exceeded
+	var groups [][]string
+	var group []string
+	var groupSizes []image.Point
+	var groupBytes int64
+
+	for _, imgPath := range imagePaths {
+		size, nBytes, err := imageStat(imgPath, budget.Loader)
+		if err != nil {
+			return nil, fmt.Errorf("pack \"%s\": %w", imgPath, err)
+		}
+
+		// Check if this image still fit in the current group
+		sizes := append(append([]image.Point{}, groupSizes...), size)
+		canvas, _ := layout.arrange(sizes)
+		pixels := canvas.X * canvas.Y
+		longEdge, shortEdge := max(canvas.X, canvas.Y), max(min(canvas.X, canvas.Y), 1)
+		fit := pixels <= budget.MaxPixels &&
+			groupBytes+nBytes <= budget.MaxBytes &&
+			len(sizes) <= budget.MaxPages &&
+			longEdge <= budget.MaxLongEdge &&
+			float64(longEdge) <= float64(shortEdge)*budget.MaxAspect
+
+		// If not, start a new group
+		if !fit && len(group) > 0 {
+			groups = append(groups, group)
+			group, groupSizes, groupBytes = nil, nil, 0
+		}
+
+		group = append(group, imgPath)
+		groupSizes = append(groupSizes, size)
+		groupBytes += nBytes
+	}
+
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+func imageStat(imgPath string, loader Loader) (image.Point, int64, error) {
+	f, err := os.Open(imgPath)
+	if err != nil {
+		return image.Point{}, 0, err
+	}
+	defer f.Close()
+
+	fs, err := f.Stat()
+	if err != nil {
+		return image.Point{}, 0, err
+	}
+
+	if loader != nil {
+		src, err := loader(imgPath)
+		if err != nil {
+			return image.Point{}, 0, err
+		}
+		return src.Image.Bounds().Size(), fs.Size(), nil
+	}
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return image.Point{}, 0, err
+	}
+
+	return image.Pt(cfg.Width, cfg.Height), fs.Size(), nil
+}
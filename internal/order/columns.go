@@ -0,0 +1,141 @@
+package order
+
+import (
+	"image"
+	"sort"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+// sortColumns detects the columns from vertical whitespace gaps between
+// paragraphs, then reads each column from top to bottom, left to right.
+// Paragraphs that span several columns (e.g. title or wide figure caption)
+// split the page into sections, which are read from top to bottom.
+func sortColumns(paragraphs []vision.Paragraph) []vision.Paragraph {
+	if len(paragraphs) < 2 {
+		return paragraphs
+	}
+
+	gutters := columnGutters(paragraphs)
+	if len(gutters) == 0 {
+		sorted := append([]vision.Paragraph{}, paragraphs...)
+		sortVertical(sorted)
+		return sorted
+	}
+
+	type item struct {
+		paragraph vision.Paragraph
+		column    int
+	}
+
+	var items, spanning []item
+	for _, p := range paragraphs {
+		if column, inColumn := columnOf(gutters, p.BoundingBox); inColumn {
+			items = append(items, item{p, column})
+		} else {
+			spanning = append(spanning, item{p, -1})
+		}
+	}
+
+	sort.SliceStable(spanning, func(a, b int) bool {
+		return midPoint(spanning[a].paragraph.BoundingBox).Y < midPoint(spanning[b].paragraph.BoundingBox).Y
+	})
+
+	// Each spanning paragraph closes the section above it
+	sectionOf := func(rect image.Rectangle) int {
+		y := midPoint(rect).Y
+		for i, s := range spanning {
+			if y < midPoint(s.paragraph.BoundingBox).Y {
+				return i
+			}
+		}
+		return len(spanning)
+	}
+
+	sort.SliceStable(items, func(a, b int) bool {
+		rectA, rectB := items[a].paragraph.BoundingBox, items[b].paragraph.BoundingBox
+		sectionA, sectionB := sectionOf(rectA), sectionOf(rectB)
+		if sectionA != sectionB {
+			return sectionA < sectionB
+		}
+		if items[a].column != items[b].column {
+			return items[a].column < items[b].column
+		}
+		return midPoint(rectA).Y < midPoint(rectB).Y
+	})
+
+	// Merge the sections with the spanning paragraphs
+	var sorted []vision.Paragraph
+	var cursor int
+	for section := 0; section <= len(spanning); section++ {
+		for cursor < len(items) && sectionOf(items[cursor].paragraph.BoundingBox) == section {
+			sorted = append(sorted, items[cursor].paragraph)
+			cursor++
+		}
+		if section < len(spanning) {
+			sorted = append(sorted, spanning[section].paragraph)
+		}
+	}
+
+	return sorted
+}
+
+// Columns detects the columns in the same way as columns reading order, then
+// returns the column index of each paragraph, started from 0 at the left.
+// Paragraph that spans across columns gets -1. If there is only one column,
+// it returns nil.
+func Columns(paragraphs []vision.Paragraph) []int {
+	if len(paragraphs) < 2 {
+		return nil
+	}
+
+	gutters := columnGutters(paragraphs)
+	if len(gutters) == 0 {
+		return nil
+	}
+
+	columns := make([]int, len(paragraphs))
+	for i, p := range paragraphs {
+		if column, inColumn := columnOf(gutters, p.BoundingBox); inColumn {
+			columns[i] = column
+		} else {
+			columns[i] = -1
+		}
+	}
+
+	return columns
+}
+
+// columnGutters finds the vertical whitespace gaps between paragraphs. Wide
+// paragraphs are excluded while looking for the gaps, otherwise a title will
+// cover the gutter between columns.
+func columnGutters(paragraphs []vision.Paragraph) []span {
+	content := paragraphs[0].BoundingBox
+	for _, p := range paragraphs[1:] {
+		content = content.Union(p.BoundingBox)
+	}
+
+	var spans []span
+	for _, p := range paragraphs {
+		if p.BoundingBox.Dx()*2 <= content.Dx() {
+			spans = append(spans, span{p.BoundingBox.Min.X, p.BoundingBox.Max.X})
+		}
+	}
+
+	return findGaps(spans)
+}
+
+// columnOf returns the column of the rect, or false if it spans across the
+// gutters.
+func columnOf(gutters []span, rect image.Rectangle) (int, bool) {
+	column := 0
+	for _, g := range gutters {
+		if rect.Min.X < g.Max && rect.Max.X > g.Min {
+			return 0, false
+		}
+		if rect.Min.X >= g.Max {
+			column++
+		}
+	}
+	return column, true
+}
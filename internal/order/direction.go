@@ -0,0 +1,192 @@
+package order
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"unicode"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+// Directions of the text. LTR is horizontal text read from left to right,
+// RTL is horizontal text read from right to left (e.g. Arabic and Hebrew)
+// and TTB is vertical text read from top to bottom, with the columns read
+// from right to left (e.g. traditional Chinese and Japanese).
+const (
+	DirectionAuto = "auto"
+	DirectionLTR  = "ltr"
+	DirectionRTL  = "rtl"
+	DirectionTTB  = "ttb"
+)
+
+// rtlLanguages is the languages which written from right to left.
+var rtlLanguages = map[string]struct{}{
+	"ar": {}, "he": {}, "iw": {}, "fa": {}, "ur": {},
+	"yi": {}, "ps": {}, "sd": {}, "ug": {}, "dv": {},
+}
+
+// rtlScripts is used when the language is not known.
+var rtlScripts = []*unicode.RangeTable{
+	unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko,
+}
+
+func ValidateDirection(direction string) error {
+	switch direction {
+	case DirectionAuto, DirectionLTR, DirectionRTL, DirectionTTB:
+		return nil
+	default:
+		return fmt.Errorf("unknown text direction \"%s\"", direction)
+	}
+}
+
+// SetDirection fills the direction of the page and its paragraphs. In auto
+// mode the direction of each paragraph is detected, using the language hint
+// for paragraphs whose language is not detected by Vision, then the page
+// uses the direction of most symbols. Otherwise all of them use the
+// specified direction.
+func SetDirection(page vision.Page, direction, hint string) vision.Page {
+	paragraphs := make([]vision.Paragraph, len(page.Paragraphs))
+	counts := map[string]int{}
+	for i, p := range page.Paragraphs {
+		p.Direction = direction
+		if direction == DirectionAuto {
+			p.Direction = ParagraphDirection(p, hint)
+		}
+
+		paragraphs[i] = p
+		counts[p.Direction] += countSymbols(p)
+	}
+
+	page.Paragraphs = paragraphs
+	page.Direction = direction
+	if direction == DirectionAuto {
+		page.Direction = DirectionLTR
+		for _, d := range []string{DirectionRTL, DirectionTTB} {
+			if counts[d] > counts[page.Direction] {
+				page.Direction = d
+			}
+		}
+	}
+
+	return page
+}
+
+// ParagraphDirection returns the direction of a paragraph. Vertical text is
+// detected from the shape of its lines, while right to left text is detected
+// from its language, or from its script if the language is not known.
+func ParagraphDirection(p vision.Paragraph, hint string) string {
+	if isVertical(p) {
+		return DirectionTTB
+	}
+
+	language := p.Language
+	if language == "" {
+		language = hint
+	}
+
+	if language != "" {
+		if isRTLLanguage(language) {
+			return DirectionRTL
+		}
+		return DirectionLTR
+	}
+
+	// Language is unknown, so check the script of its letters
+	var nLetter, nRTL int
+	for _, l := range p.Lines {
+		for _, w := range l.Words {
+			for _, s := range w.Symbols {
+				for _, r := range s.Text {
+					if !unicode.IsLetter(r) {
+						continue
+					}
+
+					nLetter++
+					if unicode.In(r, rtlScripts...) {
+						nRTL++
+					}
+				}
+			}
+		}
+	}
+
+	if nRTL*2 > nLetter {
+		return DirectionRTL
+	}
+	return DirectionLTR
+}
+
+// isRTLLanguage checks the BCP-47 language code, e.g. "ar" or "fa-IR".
+func isRTLLanguage(language string) bool {
+	language = strings.ToLower(language)
+	if idx := strings.IndexAny(language, "-_"); idx >= 0 {
+		language = language[:idx]
+	}
+
+	_, isRTL := rtlLanguages[language]
+	return isRTL
+}
+
+// isVertical checks whether most lines in paragraph are taller than they
+// are wide. Lines with single symbol are ignored since their shape doesn't
+// tell anything.
+func isVertical(p vision.Paragraph) bool {
+	var nVertical, nHorizontal int
+	for _, l := range p.Lines {
+		var nSymbols int
+		for _, w := range l.Words {
+			nSymbols += len(w.Symbols)
+		}
+
+		if nSymbols < 2 {
+			continue
+		}
+
+		size := l.BoundingBox.Size()
+		if size.Y*2 > size.X*3 {
+			nVertical++
+		} else {
+			nHorizontal++
+		}
+	}
+
+	return nVertical > nHorizontal
+}
+
+func countSymbols(p vision.Paragraph) int {
+	var n int
+	for _, l := range p.Lines {
+		for _, w := range l.Words {
+			n += len(w.Symbols)
+		}
+	}
+	return n
+}
+
+// toReadingFrame maps the rectangle into a frame where text is read from left
+// to right and top to bottom, so the same sorting can be used for all
+// directions. For RTL the frame is mirrored horizontally, while for TTB the
+// frame is rotated so the rightmost column becomes the top line.
+func toReadingFrame(direction string, rect image.Rectangle) image.Rectangle {
+	switch direction {
+	case DirectionRTL:
+		return image.Rect(-rect.Max.X, rect.Min.Y, -rect.Min.X, rect.Max.Y)
+	case DirectionTTB:
+		return image.Rect(rect.Min.Y, -rect.Max.X, rect.Max.Y, -rect.Min.X)
+	default:
+		return rect
+	}
+}
+
+// fromReadingFrame is the inverse of toReadingFrame.
+func fromReadingFrame(direction string, rect image.Rectangle) image.Rectangle {
+	switch direction {
+	case DirectionRTL:
+		return image.Rect(-rect.Max.X, rect.Min.Y, -rect.Min.X, rect.Max.Y)
+	case DirectionTTB:
+		return image.Rect(-rect.Max.Y, rect.Min.X, -rect.Min.Y, rect.Max.X)
+	default:
+		return rect
+	}
+}
@@ -0,0 +1,96 @@
+package order
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+// Modes of reading order. Vision keeps the order returned by Google Vision,
+// vertical sorts paragraphs from top to bottom, columns detects the columns
+// by whitespace gaps and xycut uses recursive XY-cut.
+const (
+	ModeVision   = "vision"
+	ModeVertical = "vertical"
+	ModeColumns  = "columns"
+	ModeXYCut    = "xycut"
+)
+
+func Validate(mode string) error {
+	switch mode {
+	case ModeVision, ModeVertical, ModeColumns, ModeXYCut:
+		return nil
+	default:
+		return fmt.Errorf("unknown reading order \"%s\"", mode)
+	}
+}
+
+// Sort reorders paragraphs in the page following the reading order mode and
+// the text direction, which must be already resolved (i.e. not auto).
+func Sort(mode, direction string, page vision.Page) vision.Page {
+	// Sort the paragraphs in reading frame, then map them back
+	paragraphs := make([]vision.Paragraph, len(page.Paragraphs))
+	for i, p := range page.Paragraphs {
+		p.BoundingBox = toReadingFrame(direction, p.BoundingBox)
+		paragraphs[i] = p
+	}
+
+	switch mode {
+	case ModeVertical:
+		sortVertical(paragraphs)
+	case ModeColumns:
+		paragraphs = sortColumns(paragraphs)
+	case ModeXYCut:
+		paragraphs = sortXYCut(paragraphs)
+	}
+
+	for i, p := range paragraphs {
+		paragraphs[i].BoundingBox = fromReadingFrame(direction, p.BoundingBox)
+	}
+
+	page.Paragraphs = paragraphs
+	return page
+}
+
+// sortVertical sorts paragraphs from top to bottom by their middle point.
+func sortVertical(paragraphs []vision.Paragraph) {
+	sort.SliceStable(paragraphs, func(a, b int) bool {
+		return midPoint(paragraphs[a].BoundingBox).Y < midPoint(paragraphs[b].BoundingBox).Y
+	})
+}
+
+func midPoint(rect image.Rectangle) image.Point {
+	return image.Pt(rect.Min.X+rect.Dx()/2, rect.Min.Y+rect.Dy()/2)
+}
+
+// span is a range in one axis, from Min (inclusive) to Max (exclusive).
+type span struct {
+	Min, Max int
+}
+
+// findGaps merges the spans, then returns the empty gaps between them.
+func findGaps(spans []span) []span {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	sorted := append([]span{}, spans...)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Min < sorted[b].Min
+	})
+
+	var gaps []span
+	end := sorted[0].Max
+	for _, s := range sorted[1:] {
+		if s.Min > end {
+			gaps = append(gaps, span{end, s.Min})
+		}
+		if s.Max > end {
+			end = s.Max
+		}
+	}
+
+	return gaps
+}
@@ -0,0 +1,104 @@
+package order
+
+import (
+	"image"
+	"slices"
+	"testing"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+// block is a named paragraph, so the sorted order can be compared by name.
+type block struct {
+	name string
+	rect image.Rectangle
+}
+
+var (
+	// Title that spans over two columns
+	twoColumnsWithTitle = []block{
+		{"R2", image.Rect(520, 520, 900, 900)},
+		{"L1", image.Rect(100, 200, 480, 500)},
+		{"title", image.Rect(100, 100, 900, 150)},
+		{"R1", image.Rect(520, 200, 900, 500)},
+		{"L2", image.Rect(100, 520, 480, 900)},
+	}
+
+	singleColumn = []block{
+		{"P3", image.Rect(100, 620, 900, 900)},
+		{"P1", image.Rect(100, 100, 900, 300)},
+		{"P2", image.Rect(100, 320, 900, 600)},
+	}
+
+	// Vertical text in two tiers, each with two columns
+	verticalTiers = []block{
+		{"D", image.Rect(500, 600, 600, 900)},
+		{"B", image.Rect(500, 100, 600, 400)},
+		{"C", image.Rect(700, 600, 800, 900)},
+		{"A", image.Rect(700, 100, 800, 400)},
+	}
+)
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		direction string
+		blocks    []block
+		want      []string
+	}{
+		{"columns title", ModeColumns, DirectionLTR, twoColumnsWithTitle, []string{"title", "L1", "L2", "R1", "R2"}},
+		{"xycut title", ModeXYCut, DirectionLTR, twoColumnsWithTitle, []string{"title", "L1", "L2", "R1", "R2"}},
+		{"columns single", ModeColumns, DirectionLTR, singleColumn, []string{"P1", "P2", "P3"}},
+		{"xycut single", ModeXYCut, DirectionLTR, singleColumn, []string{"P1", "P2", "P3"}},
+		{"vertical single", ModeVertical, DirectionLTR, singleColumn, []string{"P1", "P2", "P3"}},
+		{"columns rtl", ModeColumns, DirectionRTL, twoColumnsWithTitle, []string{"title", "R1", "R2", "L1", "L2"}},
+		{"xycut rtl", ModeXYCut, DirectionRTL, twoColumnsWithTitle, []string{"title", "R1", "R2", "L1", "L2"}},
+		{"columns ttb", ModeColumns, DirectionTTB, verticalTiers, []string{"A", "B", "C", "D"}},
+		{"xycut ttb", ModeXYCut, DirectionTTB, verticalTiers, []string{"A", "B", "C", "D"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := map[image.Rectangle]string{}
+			var page vision.Page
+			for _, b := range tt.blocks {
+				names[b.rect] = b.name
+				page.Paragraphs = append(page.Paragraphs, vision.Paragraph{BoundingBox: b.rect})
+			}
+
+			var got []string
+			for _, p := range Sort(tt.mode, tt.direction, page).Paragraphs {
+				got = append(got, names[p.BoundingBox])
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []block
+		want   []int
+	}{
+		{"title", twoColumnsWithTitle, []int{1, 0, -1, 1, 0}},
+		{"single", singleColumn, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paragraphs []vision.Paragraph
+			for _, b := range tt.blocks {
+				paragraphs = append(paragraphs, vision.Paragraph{BoundingBox: b.rect})
+			}
+
+			if got := Columns(paragraphs); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
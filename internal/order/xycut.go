@@ -0,0 +1,67 @@
+package order
+
+import (
+	"sort"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+// sortXYCut orders paragraphs using recursive XY-cut. In each step, the
+// paragraphs are split at the widest whitespace gap, either horizontal (the
+// top part read first) or vertical (the left part read first), until no
+// more gap can be found.
+func sortXYCut(paragraphs []vision.Paragraph) []vision.Paragraph {
+	if len(paragraphs) < 2 {
+		return paragraphs
+	}
+
+	// Find the widest gap in both axis
+	var xSpans, ySpans []span
+	for _, p := range paragraphs {
+		xSpans = append(xSpans, span{p.BoundingBox.Min.X, p.BoundingBox.Max.X})
+		ySpans = append(ySpans, span{p.BoundingBox.Min.Y, p.BoundingBox.Max.Y})
+	}
+
+	xGap, xFound := widestGap(findGaps(xSpans))
+	yGap, yFound := widestGap(findGaps(ySpans))
+
+	// If there are no gap, this is a single block so just sort it vertically
+	if !xFound && !yFound {
+		sorted := append([]vision.Paragraph{}, paragraphs...)
+		sort.SliceStable(sorted, func(a, b int) bool {
+			midA, midB := midPoint(sorted[a].BoundingBox), midPoint(sorted[b].BoundingBox)
+			if midA.Y != midB.Y {
+				return midA.Y < midB.Y
+			}
+			return midA.X < midB.X
+		})
+		return sorted
+	}
+
+	// Cut at the widest gap. Horizontal cut wins the tie, since a page is
+	// usually read from top to bottom before left to right.
+	cutHorizontal := yFound && (!xFound || yGap.Max-yGap.Min >= xGap.Max-xGap.Min)
+
+	var first, second []vision.Paragraph
+	for _, p := range paragraphs {
+		if cutHorizontal && p.BoundingBox.Max.Y <= yGap.Min ||
+			!cutHorizontal && p.BoundingBox.Max.X <= xGap.Min {
+			first = append(first, p)
+		} else {
+			second = append(second, p)
+		}
+	}
+
+	return append(sortXYCut(first), sortXYCut(second)...)
+}
+
+func widestGap(gaps []span) (span, bool) {
+	var widest span
+	var found bool
+	for _, g := range gaps {
+		if !found || g.Max-g.Min > widest.Max-widest.Min {
+			widest, found = g, true
+		}
+	}
+	return widest, found
+}
@@ -0,0 +1,290 @@
+package preprocess
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/geom"
+)
+
+// DefaultMaxSkew is the max skew angle in degree that will be searched
+// by deskew step.
+const DefaultMaxSkew = 10
+
+// maxDetectSize is the max size of image used for detecting the skew and
+// orientation. Bigger image will be sampled to roughly this size.
+const maxDetectSize = 1000
+
+type point struct {
+	X, Y float64
+}
+
+// deskew detects the orientation and skew angle of the page, then rotates
+// the image so the text lines become upright and horizontal.
+func deskew(img image.Image, p Pipeline, _ float64) (image.Image, geom.Affine) {
+	maxSkew := float64(p.MaxSkew)
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxSkew
+	}
+
+	angle, found := detectRotation(toGray(img), maxSkew)
+	if !found {
+		return img, geom.Identity()
+	}
+
+	return rotate(img, angle)
+}
+
+// detectRotation returns the clockwise angle in degree that the page content
+// has been rotated from upright position.
+func detectRotation(gray *image.Gray, maxSkew float64) (float64, bool) {
+	// Sample dark pixels, relative to the image center
+	bounds := gray.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	step := int(math.Ceil(float64(max(width, height)) / maxDetectSize))
+	threshold := otsuThreshold(gray)
+	centerX, centerY := float64(width)/2, float64(height)/2
+
+	var points []point
+	for y := 0; y < height; y += step {
+		for x := 0; x < width; x += step {
+			if gray.Pix[y*gray.Stride+x] <= threshold {
+				points = append(points, point{float64(x) - centerX, float64(y) - centerY})
+			}
+		}
+	}
+
+	// If there are too few ink, don't bother
+	if len(points) < 100 {
+		return 0, false
+	}
+
+	// Text lines give sharp projection profile when they are horizontal,
+	// so find angle that gives the sharpest profile for both horizontal
+	// and vertical (rotated by 90 degree) text.
+	binSize := float64(step)
+	hAngle, hScore := searchSkew(points, 0, maxSkew, binSize)
+	vAngle, vScore := searchSkew(points, 90, maxSkew, binSize)
+
+	angle := hAngle
+	if vScore > hScore*1.5 {
+		angle = vAngle
+	}
+
+	// Profile for upside down page is the same, so differentiate it by
+	// comparing the ink above and below each line.
+	if isUpsideDown(points, angle, binSize) {
+		angle += 180
+	}
+
+	// Ignore the tiny skew since it doesn't matter
+	angle = math.Mod(angle+360, 360)
+	if math.Abs(angle) < 0.05 || math.Abs(angle-360) < 0.05 {
+		return 0, false
+	}
+
+	return angle, true
+}
+
+// searchSkew looks for the angle around base that gives the sharpest
+// projection profile. First it does coarse search, then refines it.
+func searchSkew(points []point, base, maxSkew, binSize float64) (float64, float64) {
+	bestAngle, bestScore := base, profileScore(points, base, binSize)
+	search := func(from, to, step float64) {
+		for angle := from; angle <= to+1e-9; angle += step {
+			if score := profileScore(points, angle, binSize); score > bestScore {
+				bestAngle, bestScore = angle, score
+			}
+		}
+	}
+
+	search(base-maxSkew, base+maxSkew, 0.5)
+	search(bestAngle-0.5, bestAngle+0.5, 0.05)
+	return bestAngle, bestScore
+}
+
+// profileScore returns how sharp is the horizontal projection profile of the
+// points after rotated back by the specified angle.
+func profileScore(points []point, angle, binSize float64) float64 {
+	histogram := projectRows(points, angle, binSize)
+
+	// Use ratio between mean of squares and square of mean, so the score
+	// doesn't depend on the number of rows.
+	var sum, sumSquares float64
+	for _, count := range histogram {
+		sum += count
+		sumSquares += count * count
+	}
+
+	n := float64(len(histogram))
+	return sumSquares * n / (sum * sum)
+}
+
+// isUpsideDown checks the upright text lines. In most scripts, ascenders and
+// capitals are more common than descenders, so the ink above the core of
+// each line is heavier than the ink below it. If it's the other way around,
+// the page is most likely upside down.
+func isUpsideDown(points []point, angle, binSize float64) bool {
+	histogram := projectRows(points, angle, binSize)
+
+	var ascender, descender float64
+	for start := 0; start < len(histogram); {
+		// Find the line, i.e. the consecutive rows that have ink
+		if histogram[start] == 0 {
+			start++
+			continue
+		}
+
+		end := start
+		var peak float64
+		for end < len(histogram) && histogram[end] > 0 {
+			peak = math.Max(peak, histogram[end])
+			end++
+		}
+
+		// Find the core of the line, which has at least half of peak ink
+		coreStart, coreEnd := start, end-1
+		for histogram[coreStart] < peak/2 {
+			coreStart++
+		}
+		for histogram[coreEnd] < peak/2 {
+			coreEnd--
+		}
+
+		for i := start; i < coreStart; i++ {
+			ascender += histogram[i]
+		}
+		for i := coreEnd + 1; i < end; i++ {
+			descender += histogram[i]
+		}
+
+		start = end
+	}
+
+	return descender > ascender*1.2
+}
+
+// projectRows rotates the points back by the specified angle, then counts
+// the points in each row.
+func projectRows(points []point, angle, binSize float64) []float64 {
+	rad := angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	ys := make([]float64, len(points))
+	for i, pt := range points {
+		ys[i] = -pt.X*sin + pt.Y*cos
+		minY, maxY = math.Min(minY, ys[i]), math.Max(maxY, ys[i])
+	}
+
+	histogram := make([]float64, int((maxY-minY)/binSize)+1)
+	for _, y := range ys {
+		histogram[int((y-minY)/binSize)]++
+	}
+	return histogram
+}
+
+// rotate rotates the image counter clockwise by the specified angle, so
+// content that rotated clockwise by that angle become upright. Area outside
+// the source image is filled with white.
+func rotate(img image.Image, angle float64) (image.Image, geom.Affine) {
+	src := toRGBA(img)
+	srcW, srcH := float64(src.Rect.Dx()), float64(src.Rect.Dy())
+
+	rad := angle * math.Pi / 180
+	sin, cos := math.Abs(math.Sin(rad)), math.Abs(math.Cos(rad))
+	dstW := int(math.Round(srcW*cos + srcH*sin))
+	dstH := int(math.Round(srcW*sin + srcH*cos))
+
+	// Transform that maps point in rotated image back to the source
+	transform := geom.Translate(srcW/2, srcH/2).Then(
+		geom.Rotate(angle, 0, 0).Then(
+			geom.Translate(-float64(dstW)/2, -float64(dstH)/2)))
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			sx, sy := transform.Apply(float64(x)+0.5, float64(y)+0.5)
+			dst.SetRGBA(x, y, bilinear(src, sx-0.5, sy-0.5))
+		}
+	}
+
+	return dst, transform
+}
+
+// bilinear samples the image at the specified position. Pixels outside the
+// image is considered as white.
+func bilinear(img *image.RGBA, x, y float64) color.RGBA {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+
+	pixel := func(px, py int) [4]float64 {
+		if !image.Pt(px, py).In(img.Rect) {
+			return [4]float64{255, 255, 255, 255}
+		}
+		i := img.PixOffset(px, py)
+		return [4]float64{
+			float64(img.Pix[i]), float64(img.Pix[i+1]),
+			float64(img.Pix[i+2]), float64(img.Pix[i+3])}
+	}
+
+	ix, iy := int(x0), int(y0)
+	p00, p10 := pixel(ix, iy), pixel(ix+1, iy)
+	p01, p11 := pixel(ix, iy+1), pixel(ix+1, iy+1)
+
+	var result [4]uint8
+	for c := range result {
+		top := p00[c]*(1-fx) + p10[c]*fx
+		bottom := p01[c]*(1-fx) + p11[c]*fx
+		result[c] = uint8(math.Round(top*(1-fy) + bottom*fy))
+	}
+
+	return color.RGBA{R: result[0], G: result[1], B: result[2], A: result[3]}
+}
+
+// otsuThreshold returns the luminance that best separates ink and paper.
+func otsuThreshold(gray *image.Gray) uint8 {
+	var histogram [256]float64
+	for _, v := range gray.Pix {
+		histogram[v]++
+	}
+
+	var total, sum float64
+	for v, count := range histogram {
+		total += count
+		sum += float64(v) * count
+	}
+
+	var bestThreshold uint8
+	var bestVariance, bgWeight, bgSum float64
+	for v, count := range histogram {
+		bgWeight += count
+		bgSum += float64(v) * count
+		fgWeight := total - bgWeight
+		if bgWeight == 0 || fgWeight == 0 {
+			continue
+		}
+
+		bgMean := bgSum / bgWeight
+		fgMean := (sum - bgSum) / fgWeight
+		variance := bgWeight * fgWeight * (bgMean - fgMean) * (bgMean - fgMean)
+		if variance > bestVariance {
+			bestThreshold, bestVariance = uint8(v), variance
+		}
+	}
+
+	return bestThreshold
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, isRGBA := img.(*image.RGBA); isRGBA && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,64 @@
+package preprocess
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// readDPI reads the image resolution from pHYs chunk of PNG file. If the
+// resolution is not available, DefaultDPI will be returned.
+func readDPI(path string) float64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return DefaultDPI
+	}
+	defer f.Close()
+
+	// Make sure it's PNG file
+	r := bufio.NewReader(f)
+	signature := make([]byte, len(pngSignature))
+	if _, err = io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return DefaultDPI
+	}
+
+	// Look for pHYs chunk, which must be placed before the image data
+	header := make([]byte, 8)
+	for {
+		if _, err = io.ReadFull(r, header); err != nil {
+			return DefaultDPI
+		}
+
+		length := binary.BigEndian.Uint32(header[:4])
+		chunkType := string(header[4:])
+
+		switch chunkType {
+		case "IDAT", "IEND":
+			return DefaultDPI
+		case "pHYs":
+			data := make([]byte, 9)
+			if length != 9 {
+				return DefaultDPI
+			}
+			if _, err = io.ReadFull(r, data); err != nil {
+				return DefaultDPI
+			}
+
+			// Unit 1 means pixels per meter, else the unit is unknown
+			pixelsPerMeter := binary.BigEndian.Uint32(data[:4])
+			if data[8] != 1 || pixelsPerMeter == 0 {
+				return DefaultDPI
+			}
+			return float64(pixelsPerMeter) * 0.0254
+		}
+
+		// Skip chunk data and its CRC
+		if _, err = r.Discard(int(length) + 4); err != nil {
+			return DefaultDPI
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package preprocess
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	fp "path/filepath"
+	"strings"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/geom"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/montage"
+	"github.com/anthonynsimon/bild/imgio"
+)
+
+// DefaultDPI is used when DPI of the source image is unknown.
+const DefaultDPI = 300
+
+// Step modifies the image. Beside the modified image, it also returns the
+// transform that map coordinates in modified image back to the input image.
+type Step func(img image.Image, p Pipeline, dpi float64) (image.Image, geom.Affine)
+
+var steps = map[string]Step{
+	"grayscale": grayscale,
+	"contrast":  contrastStretch,
+	"binarize":  adaptiveBinarize,
+	"despeckle": despeckle,
+	"sharpen":   sharpen,
+	"crop":      borderCrop,
+	"deskew":    deskew,
+	"downscale": downscaleToDPI,
+}
+
+type Pipeline struct {
+	Steps     []string
+	TargetDPI int
+	SourceDPI int
+	MaxSkew   int
+	CacheDir  string
+}
+
+type cacheMeta struct {
+	Steps     []string
+	Bounds    image.Rectangle
+	Transform geom.Affine
+}
+
+func (p Pipeline) Validate() error {
+	for _, name := range p.Steps {
+		if _, exist := steps[name]; !exist {
+			return fmt.Errorf("unknown preprocess step \"%s\"", name)
+		}
+	}
+	return nil
+}
+
+// Load opens the image in path then applies each preprocess step to it. The
+// result is cached, so the next load for the same image will be faster.
+func (p Pipeline) Load(path string) (montage.Source, error) {
+	// If there are no steps, just open the image
+	if len(p.Steps) == 0 {
+		return montage.OpenSource(path)
+	}
+
+	// Check if the preprocess result already cached
+	cacheKey, err := p.cacheKey(path)
+	if err != nil {
+		return montage.Source{}, err
+	}
+
+	imgName := strings.TrimSuffix(fp.Base(path), fp.Ext(path))
+	cacheName := fp.Join(p.CacheDir, imgName+"-"+cacheKey)
+	if src, err := loadCache(cacheName); err == nil {
+		return src, nil
+	}
+
+	// Open the image
+	img, err := imgio.Open(path)
+	if err != nil {
+		return montage.Source{}, err
+	}
+
+	dpi := float64(p.SourceDPI)
+	if dpi <= 0 {
+		dpi = readDPI(path)
+	}
+
+	// Apply each step
+	srcBounds := img.Bounds()
+	transform := geom.Translate(float64(srcBounds.Min.X), float64(srcBounds.Min.Y))
+	img = normalizeOrigin(img)
+
+	for _, name := range p.Steps {
+		var stepTransform geom.Affine
+		img, stepTransform = steps[name](img, p, dpi)
+		transform = transform.Then(stepTransform)
+		dpi *= scaleFactor(stepTransform)
+	}
+
+	src := montage.Source{
+		Image:     img,
+		Bounds:    srcBounds,
+		Transform: transform,
+	}
+
+	// Save the result to cache
+	if p.CacheDir != "" {
+		err = saveCache(cacheName, src, p.Steps)
+		if err != nil {
+			return montage.Source{}, fmt.Errorf("save preprocess cache: %w", err)
+		}
+	}
+
+	return src, nil
+}
+
+func (p Pipeline) cacheKey(path string) (string, error) {
+	fs, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s|%d|%d|%d|%d|%d",
+		strings.Join(p.Steps, ","), p.TargetDPI, p.SourceDPI, p.MaxSkew,
+		fs.Size(), fs.ModTime().UnixNano())
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+func loadCache(cacheName string) (montage.Source, error) {
+	// Open the metadata
+	f, err := os.Open(cacheName + ".json")
+	if err != nil {
+		return montage.Source{}, err
+	}
+	defer f.Close()
+
+	var meta cacheMeta
+	if err = json.NewDecoder(f).Decode(&meta); err != nil {
+		return montage.Source{}, err
+	}
+
+	// Open the image
+	img, err := imgio.Open(cacheName + ".png")
+	if err != nil {
+		return montage.Source{}, err
+	}
+
+	return montage.Source{
+		Image:     img,
+		Bounds:    meta.Bounds,
+		Transform: meta.Transform,
+	}, nil
+}
+
+func saveCache(cacheName string, src montage.Source, steps []string) error {
+	// Make sure the cache dir exists, since image might be loaded before the
+	// output dirs prepared, e.g. while packing montages.
+	err := os.MkdirAll(fp.Dir(cacheName), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// Save the image
+	err = imgio.Save(cacheName+".png", src.Image, imgio.PNGEncoder())
+	if err != nil {
+		return err
+	}
+
+	// Save the metadata
+	f, err := os.Create(cacheName + ".json")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(&cacheMeta{
+		Steps:     steps,
+		Bounds:    src.Bounds,
+		Transform: src.Transform,
+	})
+}
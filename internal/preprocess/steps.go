@@ -0,0 +1,248 @@
+package preprocess
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/geom"
+	"github.com/anthonynsimon/bild/adjust"
+	"github.com/anthonynsimon/bild/effect"
+	"github.com/anthonynsimon/bild/transform"
+)
+
+func grayscale(img image.Image, _ Pipeline, _ float64) (image.Image, geom.Affine) {
+	return effect.Grayscale(img), geom.Identity()
+}
+
+func contrastStretch(img image.Image, _ Pipeline, _ float64) (image.Image, geom.Affine) {
+	// Find the darkest and brightest luminance, ignoring 1% outliers
+	var histogram [256]int
+	gray := toGray(img)
+	for _, v := range gray.Pix {
+		histogram[v]++
+	}
+
+	low, high := percentile(histogram, 0.01), percentile(histogram, 0.99)
+	if high <= low {
+		return img, geom.Identity()
+	}
+
+	// Stretch the colors so the range become 0-255
+	scale := 255 / float64(high-low)
+	stretch := func(v uint8) uint8 {
+		f := (float64(v) - float64(low)) * scale
+		return uint8(math.Max(0, math.Min(255, f)))
+	}
+
+	stretched := adjust.Apply(img, func(c color.RGBA) color.RGBA {
+		return color.RGBA{R: stretch(c.R), G: stretch(c.G), B: stretch(c.B), A: c.A}
+	})
+
+	return stretched, geom.Identity()
+}
+
+func adaptiveBinarize(img image.Image, _ Pipeline, dpi float64) (image.Image, geom.Affine) {
+	// Use window around 1/10 inch, which is roughly the size of a letter
+	gray := toGray(img)
+	radius := int(math.Max(7, dpi/10))
+	integral := newIntegralImage(gray)
+
+	// Pixel that darker than the mean of its window is considered as text
+	bounds := gray.Bounds()
+	result := image.NewGray(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			mean := integral.mean(x-radius, y-radius, x+radius+1, y+radius+1)
+			v := gray.Pix[y*gray.Stride+x]
+			if float64(v) < mean*0.9 {
+				result.Pix[y*result.Stride+x] = 0
+			} else {
+				result.Pix[y*result.Stride+x] = 255
+			}
+		}
+	}
+
+	return result, geom.Identity()
+}
+
+func despeckle(img image.Image, _ Pipeline, _ float64) (image.Image, geom.Affine) {
+	return effect.Median(img, 1), geom.Identity()
+}
+
+func sharpen(img image.Image, _ Pipeline, _ float64) (image.Image, geom.Affine) {
+	return effect.Sharpen(img), geom.Identity()
+}
+
+func borderCrop(img image.Image, _ Pipeline, dpi float64) (image.Image, geom.Affine) {
+	// Count dark pixels in each column
+	gray := toGray(img)
+	bounds := gray.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	colCounts := make([]int, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if gray.Pix[y*gray.Stride+x] < 128 {
+				colCounts[x]++
+			}
+		}
+	}
+
+	// From each edge, skip lines that either empty or mostly dark,
+	// since those are margin or shadow of the scanner.
+	isBorder := func(count, length int) bool {
+		ratio := float64(count) / float64(length)
+		return ratio < 0.002 || ratio > 0.9
+	}
+
+	minX, maxX := 0, width
+	for minX < maxX && isBorder(colCounts[minX], height) {
+		minX++
+	}
+	for maxX > minX && isBorder(colCounts[maxX-1], height) {
+		maxX--
+	}
+
+	// Count dark pixels in each row, ignoring the cropped columns so the
+	// vertical shadow doesn't count as content.
+	rowCounts := make([]int, height)
+	for y := 0; y < height; y++ {
+		for x := minX; x < maxX; x++ {
+			if gray.Pix[y*gray.Stride+x] < 128 {
+				rowCounts[y]++
+			}
+		}
+	}
+
+	minY, maxY := 0, height
+	for minY < maxY && isBorder(rowCounts[minY], maxX-minX) {
+		minY++
+	}
+	for maxY > minY && isBorder(rowCounts[maxY-1], maxX-minX) {
+		maxY--
+	}
+
+	// If nothing left, keep the image as it is
+	if minX >= maxX || minY >= maxY {
+		return img, geom.Identity()
+	}
+
+	// Keep a bit of margin around the content
+	margin := int(dpi / 20)
+	cropRect := image.Rect(minX-margin, minY-margin, maxX+margin, maxY+margin)
+	cropRect = cropRect.Intersect(image.Rect(0, 0, width, height))
+
+	cropped := image.NewRGBA(image.Rect(0, 0, cropRect.Dx(), cropRect.Dy()))
+	draw.Draw(cropped, cropped.Rect, img, cropRect.Min, draw.Src)
+	return cropped, geom.Translate(float64(cropRect.Min.X), float64(cropRect.Min.Y))
+}
+
+func downscaleToDPI(img image.Image, p Pipeline, dpi float64) (image.Image, geom.Affine) {
+	// Only downscale when the image resolution is higher than target
+	if p.TargetDPI <= 0 || dpi <= float64(p.TargetDPI) {
+		return img, geom.Identity()
+	}
+
+	factor := float64(p.TargetDPI) / dpi
+	size := img.Bounds().Size()
+	newWidth := int(math.Round(float64(size.X) * factor))
+	newHeight := int(math.Round(float64(size.Y) * factor))
+	if newWidth < 1 || newHeight < 1 {
+		return img, geom.Identity()
+	}
+
+	resized := transform.Resize(img, newWidth, newHeight, transform.Linear)
+	return resized, geom.Scale(
+		float64(size.X)/float64(newWidth),
+		float64(size.Y)/float64(newHeight))
+}
+
+func toGray(img image.Image) *image.Gray {
+	if gray, isGray := img.(*image.Gray); isGray && gray.Rect.Min == (image.Point{}) {
+		return gray
+	}
+
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Rect, img, bounds.Min, draw.Src)
+	return gray
+}
+
+// normalizeOrigin makes sure the image bounds start from (0, 0), so the
+// coordinates returned by Vision match the image.
+func normalizeOrigin(img image.Image) image.Image {
+	bounds := img.Bounds()
+	if bounds.Min == (image.Point{}) {
+		return img
+	}
+
+	normalized := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(normalized, normalized.Rect, img, bounds.Min, draw.Src)
+	return normalized
+}
+
+func percentile(histogram [256]int, p float64) int {
+	var total int
+	for _, count := range histogram {
+		total += count
+	}
+
+	target := int(float64(total) * p)
+	var cumulative int
+	for v, count := range histogram {
+		cumulative += count
+		if cumulative > target {
+			return v
+		}
+	}
+
+	return 255
+}
+
+// scaleFactor returns how much the image resolution changed by a step,
+// judging from its transform back to the input image.
+func scaleFactor(t geom.Affine) float64 {
+	scale := math.Hypot(t.A, t.D)
+	if scale == 0 {
+		return 1
+	}
+	return 1 / scale
+}
+
+type integralImage struct {
+	width  int
+	height int
+	sums   []float64
+}
+
+func newIntegralImage(gray *image.Gray) integralImage {
+	bounds := gray.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	sums := make([]float64, (width+1)*(height+1))
+
+	for y := 0; y < height; y++ {
+		var rowSum float64
+		for x := 0; x < width; x++ {
+			rowSum += float64(gray.Pix[y*gray.Stride+x])
+			sums[(y+1)*(width+1)+x+1] = sums[y*(width+1)+x+1] + rowSum
+		}
+	}
+
+	return integralImage{width: width, height: height, sums: sums}
+}
+
+func (ii integralImage) mean(x0, y0, x1, y1 int) float64 {
+	// Clamp the window inside the image
+	x0, y0 = max(x0, 0), max(y0, 0)
+	x1, y1 = min(x1, ii.width), min(y1, ii.height)
+	area := (x1 - x0) * (y1 - y0)
+	if area <= 0 {
+		return 0
+	}
+
+	stride := ii.width + 1
+	sum := ii.sums[y1*stride+x1] - ii.sums[y0*stride+x1] -
+		ii.sums[y1*stride+x0] + ii.sums[y0*stride+x0]
+	return sum / float64(area)
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	gcs "google.golang.org/api/storage/v1"
+)
+
+// GCS is storage in Google Cloud Storage bucket. The credentials are taken
+// from the application default credentials, same as Vision API.
+type GCS struct {
+	Bucket string
+	Prefix string
+
+	service *gcs.Service
+}
+
+// NewGCS opens bucket in location with format "gs://bucket/optional/prefix".
+func NewGCS(ctx context.Context, location string) (*GCS, error) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, "gs://"), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("invalid GCS location \"%s\"", location)
+	}
+
+	service, err := gcs.NewService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GCS{
+		Bucket:  bucket,
+		Prefix:  strings.Trim(prefix, "/"),
+		service: service,
+	}, nil
+}
+
+func (g *GCS) URI(name string) string {
+	uri := "gs://" + g.Bucket + "/" + g.object(name)
+	if strings.HasSuffix(name, "/") {
+		uri += "/"
+	}
+	return uri
+}
+
+func (g *GCS) Put(ctx context.Context, name string, data []byte) error {
+	obj := &gcs.Object{Name: g.object(name)}
+	_, err := g.service.Objects.Insert(g.Bucket, obj).
+		Media(bytes.NewReader(data)).
+		Context(ctx).
+		Do()
+	return err
+}
+
+func (g *GCS) Get(ctx context.Context, name string) ([]byte, error) {
+	resp, err := g.service.Objects.Get(g.Bucket, g.object(name)).
+		Context(ctx).
+		Download()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+func (g *GCS) List(ctx context.Context, prefix string) ([]string, error) {
+	// Objects are listed using the full name, so strip the storage prefix
+	fullPrefix := g.object(prefix)
+	if strings.HasSuffix(prefix, "/") {
+		fullPrefix += "/"
+	}
+
+	var names []string
+	err := g.service.Objects.List(g.Bucket).
+		Prefix(fullPrefix).
+		Pages(ctx, func(objects *gcs.Objects) error {
+			for _, obj := range objects.Items {
+				name := obj.Name
+				if g.Prefix != "" {
+					name = strings.TrimPrefix(name, g.Prefix+"/")
+				}
+				names = append(names, name)
+			}
+			return nil
+		})
+
+	sort.Strings(names)
+	return names, err
+}
+
+func (g *GCS) Delete(ctx context.Context, name string) error {
+	err := g.service.Objects.Delete(g.Bucket, g.object(name)).Context(ctx).Do()
+	if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (g *GCS) object(name string) string {
+	if g.Prefix == "" {
+		return strings.TrimSuffix(name, "/")
+	}
+	return path.Join(g.Prefix, name)
+}
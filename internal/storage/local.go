@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	fp "path/filepath"
+	"sort"
+	"strings"
+)
+
+// Local is storage in local directory. Vision API can't access it, so it's
+// only useful as stand-in for GCS in tests, together with fake annotator that
+// reads and writes the file URI.
+type Local struct {
+	Dir string
+}
+
+func NewLocal(dir string) (*Local, error) {
+	absDir, err := fp.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(absDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	return &Local{Dir: absDir}, nil
+}
+
+func (l *Local) URI(name string) string {
+	return "file://" + fp.ToSlash(l.path(name))
+}
+
+func (l *Local) Put(ctx context.Context, name string, data []byte) error {
+	dst := l.path(name)
+	if err := os.MkdirAll(fp.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+func (l *Local) Get(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(l.path(name))
+}
+
+func (l *Local) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := fp.WalkDir(l.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		name, err := fp.Rel(l.Dir, path)
+		if err != nil {
+			return err
+		}
+
+		name = fp.ToSlash(name)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+
+	sort.Strings(names)
+	return names, err
+}
+
+func (l *Local) Delete(ctx context.Context, name string) error {
+	err := os.Remove(l.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (l *Local) path(name string) string {
+	return fp.Join(l.Dir, fp.FromSlash(name))
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+	"strings"
+)
+
+// Storage is the place where input and output of async OCR are kept. The
+// names are relative to the root of the storage, using slash as separator.
+type Storage interface {
+	// URI returns the location of the object as understood by Vision API.
+	URI(name string) string
+	Put(ctx context.Context, name string, data []byte) error
+	Get(ctx context.Context, name string) ([]byte, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// New opens the storage in the specified location. Location that started
+// with "gs://" is opened as Google Cloud Storage, while the rest is opened as
+// local directory. Vision API only accepts GCS, so local directory is only
+// useful for testing.
+func New(ctx context.Context, location string) (Storage, error) {
+	if strings.HasPrefix(location, "gs://") {
+		return NewGCS(ctx, location)
+	}
+	return NewLocal(location)
+}
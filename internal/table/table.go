@@ -0,0 +1,364 @@
+package table
+
+import (
+	"image"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/order"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+const (
+	// cellGapRatio is the min horizontal gap between words, relative to the
+	// median word height, to be put in different cells.
+	cellGapRatio = 1.5
+
+	// rowGapRatio is the max vertical gap between rows of the same table,
+	// relative to the median word height.
+	rowGapRatio = 2.0
+
+	// minRows is the min number of rows for table that detected from the
+	// word layout. Table marked by Vision only needs two rows.
+	minRows = 3
+
+	// minProseLines is the min number of lines for paragraph to be counted
+	// as body text while detecting the text columns. Cells of a table are
+	// usually short, so they don't form text columns.
+	minProseLines = 3
+
+	// minNumericRatio is the min ratio of numeric cells for table whose
+	// cells are not narrow, e.g. table of figures with long labels.
+	minNumericRatio = 0.5
+)
+
+// Cell is a cell in table, which might be empty.
+type Cell struct {
+	Words       []vision.Word
+	BoundingBox image.Rectangle
+}
+
+func (c Cell) Text() string {
+	var texts []string
+	for _, w := range c.Words {
+		texts = append(texts, w.Text())
+	}
+	return strings.Join(texts, " ")
+}
+
+// Table is a grid of cells, where every row has the same number of cells.
+type Table struct {
+	Rows        [][]Cell
+	BoundingBox image.Rectangle
+}
+
+// Detect reconstructs the tables in page. The regions marked as table by
+// Vision are used first, then the rest of page is searched for rows of words
+// that aligned in several columns. The running headers and footers are
+// ignored, and so are the rows that made by lines in the text columns.
+func Detect(page vision.Page) []Table {
+	// Collect the words
+	var words []vision.Word
+	var prose []vision.Paragraph
+	for _, p := range page.Paragraphs {
+		switch p.Role {
+		case vision.RoleHeader, vision.RoleFooter, vision.RolePageNumber:
+			continue
+		}
+
+		for _, l := range p.Lines {
+			words = append(words, l.Words...)
+		}
+
+		if len(p.Lines) >= minProseLines {
+			prose = append(prose, p)
+		}
+	}
+
+	// Find the text column of words in body text, keyed by their bounds
+	wordColumns := map[image.Rectangle]int{}
+	for i, column := range order.Columns(prose) {
+		if column < 0 {
+			continue
+		}
+
+		for _, l := range prose[i].Lines {
+			for _, w := range l.Words {
+				wordColumns[w.BoundingBox] = column
+			}
+		}
+	}
+
+	if len(words) == 0 {
+		return nil
+	}
+
+	var heights []int
+	for _, w := range words {
+		heights = append(heights, w.BoundingBox.Dy())
+	}
+	sort.Ints(heights)
+	wordHeight := float64(max(heights[len(heights)/2], 1))
+
+	// Build tables from regions marked by Vision
+	var tables []Table
+	for _, r := range page.Regions {
+		if r.Type != vision.RegionTable {
+			continue
+		}
+
+		var inside, outside []vision.Word
+		for _, w := range words {
+			if midPoint(w.BoundingBox).In(r.BoundingBox) {
+				inside = append(inside, w)
+			} else {
+				outside = append(outside, w)
+			}
+		}
+
+		if t, valid := build(inside, wordHeight); valid && len(t.Rows) >= 2 {
+			tables = append(tables, t)
+			words = outside
+		}
+	}
+
+	// Look for consecutive rows that split into several cells
+	rows := groupRows(words)
+	for start := 0; start < len(rows); {
+		if len(splitCells(rows[start], wordHeight)) < 2 {
+			start++
+			continue
+		}
+
+		end := start + 1
+		for end < len(rows) && len(splitCells(rows[end], wordHeight)) >= 2 &&
+			rowGap(rows[end-1], rows[end]) <= wordHeight*rowGapRatio {
+			end++
+		}
+
+		if end-start >= minRows {
+			var tableWords []vision.Word
+			for _, row := range rows[start:end] {
+				tableWords = append(tableWords, row...)
+			}
+
+			if isTextColumns(tableWords, wordColumns) {
+				start = end
+				continue
+			}
+
+			if t, valid := build(tableWords, wordHeight); valid && isGrid(t) {
+				tables = append(tables, t)
+			}
+		}
+
+		start = end
+	}
+
+	sort.Slice(tables, func(a, b int) bool {
+		return tables[a].BoundingBox.Min.Y < tables[b].BoundingBox.Min.Y
+	})
+
+	return tables
+}
+
+// build arranges the words into grid. The columns are separated by vertical
+// gutters, i.e. whitespace that runs through all rows. It's only valid if
+// there are at least two columns.
+func build(words []vision.Word, wordHeight float64) (Table, bool) {
+	rows := groupRows(words)
+	if len(rows) == 0 {
+		return Table{}, false
+	}
+
+	// Split each row into cells, then find the table bounds
+	rowCells := make([][]Cell, len(rows))
+	var bounds image.Rectangle
+	for i, row := range rows {
+		rowCells[i] = splitCells(row, wordHeight)
+		for _, c := range rowCells[i] {
+			bounds = bounds.Union(c.BoundingBox)
+		}
+	}
+
+	// Find the gutters. Wide cells (e.g. title that spans several columns)
+	// are excluded, otherwise they will cover the gutters.
+	type span struct{ min, max int }
+	var spans []span
+	for _, cells := range rowCells {
+		for _, c := range cells {
+			if c.BoundingBox.Dx()*2 <= bounds.Dx() {
+				spans = append(spans, span{c.BoundingBox.Min.X, c.BoundingBox.Max.X})
+			}
+		}
+	}
+
+	sort.Slice(spans, func(a, b int) bool {
+		return spans[a].min < spans[b].min
+	})
+
+	var gutters []int
+	if len(spans) > 0 {
+		end := spans[0].max
+		for _, s := range spans[1:] {
+			if s.min > end {
+				gutters = append(gutters, (end+s.min)/2)
+			}
+			end = max(end, s.max)
+		}
+	}
+
+	if len(gutters) == 0 {
+		return Table{}, false
+	}
+
+	// Put each cell to its column, merging the cells in the same column
+	t := Table{BoundingBox: bounds}
+	for _, cells := range rowCells {
+		row := make([]Cell, len(gutters)+1)
+		for _, c := range cells {
+			column := sort.SearchInts(gutters, c.BoundingBox.Min.X)
+			if row[column].Words == nil {
+				row[column] = c
+				continue
+			}
+
+			row[column].Words = append(row[column].Words, c.Words...)
+			row[column].BoundingBox = row[column].BoundingBox.Union(c.BoundingBox)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+
+	return t, true
+}
+
+// isGrid checks whether the table detected from word layout is likely a real
+// table, not text in several columns. The table is accepted if its cells are
+// narrow compared to the column width, e.g. list of labels and values, or if
+// most of its cells are numbers.
+func isGrid(t Table) bool {
+	var nCells, nNumeric, totalWidth int
+	for _, row := range t.Rows {
+		for _, c := range row {
+			if len(c.Words) == 0 {
+				continue
+			}
+
+			nCells++
+			totalWidth += c.BoundingBox.Dx()
+			if isNumeric(c.Text()) {
+				nNumeric++
+			}
+		}
+	}
+
+	if nCells == 0 {
+		return false
+	}
+
+	// Average cell width must be at most half of the column width
+	nColumns := len(t.Rows[0])
+	narrow := totalWidth*2*nColumns <= t.BoundingBox.Dx()*nCells
+	numeric := float64(nNumeric) >= float64(nCells)*minNumericRatio
+	return narrow || numeric
+}
+
+// isTextColumns checks whether most of the words come from body text in
+// different text columns, i.e. the rows are lines of the columns that happen
+// to be aligned.
+func isTextColumns(words []vision.Word, wordColumns map[image.Rectangle]int) bool {
+	var nInColumn int
+	columns := map[int]struct{}{}
+	for _, w := range words {
+		if column, exist := wordColumns[w.BoundingBox]; exist {
+			columns[column] = struct{}{}
+			nInColumn++
+		}
+	}
+
+	return len(columns) >= 2 && nInColumn*2 >= len(words)
+}
+
+// isNumeric checks whether most letters and digits in the text are digits,
+// e.g. "1,234.5", "12%" or "Rp 300".
+func isNumeric(text string) bool {
+	var nDigit, nLetter int
+	for _, r := range text {
+		switch {
+		case unicode.IsDigit(r):
+			nDigit++
+		case unicode.IsLetter(r):
+			nLetter++
+		}
+	}
+	return nDigit > 0 && nDigit >= nLetter
+}
+
+// groupRows groups the words into rows, where each row sorted from left to
+// right. Word is put in the row if it overlaps at least half of its height.
+func groupRows(words []vision.Word) [][]vision.Word {
+	sorted := append([]vision.Word{}, words...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return midPoint(sorted[a].BoundingBox).Y < midPoint(sorted[b].BoundingBox).Y
+	})
+
+	var rows [][]vision.Word
+	var rowRect image.Rectangle
+	for _, w := range sorted {
+		rect := w.BoundingBox
+		overlap := min(rect.Max.Y, rowRect.Max.Y) - max(rect.Min.Y, rowRect.Min.Y)
+		if len(rows) > 0 && overlap*2 >= min(rect.Dy(), rowRect.Dy()) {
+			rows[len(rows)-1] = append(rows[len(rows)-1], w)
+			rowRect = rowRect.Union(rect)
+			continue
+		}
+
+		rows = append(rows, []vision.Word{w})
+		rowRect = rect
+	}
+
+	for _, row := range rows {
+		sort.SliceStable(row, func(a, b int) bool {
+			return row[a].BoundingBox.Min.X < row[b].BoundingBox.Min.X
+		})
+	}
+
+	return rows
+}
+
+// splitCells splits the row at the wide horizontal gaps between words.
+func splitCells(row []vision.Word, wordHeight float64) []Cell {
+	var cells []Cell
+	for _, w := range row {
+		if n := len(cells); n > 0 {
+			gap := w.BoundingBox.Min.X - cells[n-1].BoundingBox.Max.X
+			if float64(gap) < wordHeight*cellGapRatio {
+				cells[n-1].Words = append(cells[n-1].Words, w)
+				cells[n-1].BoundingBox = cells[n-1].BoundingBox.Union(w.BoundingBox)
+				continue
+			}
+		}
+
+		cells = append(cells, Cell{Words: []vision.Word{w}, BoundingBox: w.BoundingBox})
+	}
+	return cells
+}
+
+func rowGap(above, below []vision.Word) float64 {
+	var aboveMax int
+	for _, w := range above {
+		aboveMax = max(aboveMax, w.BoundingBox.Max.Y)
+	}
+
+	belowMin := below[0].BoundingBox.Min.Y
+	for _, w := range below {
+		belowMin = min(belowMin, w.BoundingBox.Min.Y)
+	}
+
+	return float64(belowMin - aboveMax)
+}
+
+func midPoint(rect image.Rectangle) image.Point {
+	return image.Pt(rect.Min.X+rect.Dx()/2, rect.Min.Y+rect.Dy()/2)
+}
@@ -0,0 +1,177 @@
+package table
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/vision"
+)
+
+const (
+	wordHeight = 20
+	lineHeight = 30
+)
+
+// textLine creates a line at y, with the texts put in order from left to
+// right. Each text starts at its x, and its words are separated by a space
+// that narrower than the cell gap.
+func textLine(y int, texts map[int]string) vision.Line {
+	var l vision.Line
+	for x, text := range texts {
+		for _, field := range strings.Fields(text) {
+			var symbols []vision.Symbol
+			for _, r := range field {
+				symbols = append(symbols, vision.Symbol{Text: string(r)})
+			}
+
+			rect := image.Rect(x, y, x+len(symbols)*10, y+wordHeight)
+			l.Words = append(l.Words, vision.Word{Symbols: symbols, BoundingBox: rect})
+			l.BoundingBox = l.BoundingBox.Union(rect)
+			x = rect.Max.X + 10
+		}
+	}
+	return l
+}
+
+// lineParagraph creates a paragraph from the lines.
+func lineParagraph(lines ...vision.Line) vision.Paragraph {
+	p := vision.Paragraph{Lines: lines}
+	for _, l := range lines {
+		p.BoundingBox = p.BoundingBox.Union(l.BoundingBox)
+	}
+	return p
+}
+
+// textColumns creates two text columns, where the lines of both columns are
+// aligned at the same height.
+func textColumns(left, right []string) vision.Page {
+	var leftLines, rightLines []vision.Line
+	for i := range left {
+		y := 100 + i*lineHeight
+		leftLines = append(leftLines, textLine(y, map[int]string{100: left[i]}))
+		rightLines = append(rightLines, textLine(y, map[int]string{520: right[i]}))
+	}
+
+	return vision.Page{Paragraphs: []vision.Paragraph{
+		lineParagraph(leftLines...),
+		lineParagraph(rightLines...),
+	}}
+}
+
+// rowsPage creates a page where each row is a paragraph with one line.
+func rowsPage(rows ...map[int]string) vision.Page {
+	var page vision.Page
+	for i, row := range rows {
+		page.Paragraphs = append(page.Paragraphs, lineParagraph(textLine(100+i*lineHeight, row)))
+	}
+	return page
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		page vision.Page
+		want [][]string
+	}{{
+		name: "text columns",
+		page: textColumns(
+			[]string{"the empire was founded", "by the first emperor", "after the long civil", "war that ended the old", "republic of the city"},
+			[]string{"while the provinces", "were ruled by the", "governors who sent", "the taxes back to the", "treasury of the state"},
+		),
+	}, {
+		name: "text columns of numbers",
+		page: textColumns(
+			[]string{"from 1939 to 1945", "and 1946 to 1949", "then 1950 to 1953", "and 1954 to 1960"},
+			[]string{"in 1961 and 1962", "in 1963 and 1964", "in 1965 and 1966", "in 1967 and 1968"},
+		),
+	}, {
+		name: "numeric grid",
+		page: rowsPage(
+			map[int]string{100: "Item", 500: "2022", 700: "2023"},
+			map[int]string{100: "Revenue from sales", 500: "1,234", 700: "1,456"},
+			map[int]string{100: "Cost of goods sold", 500: "987", 700: "1,002"},
+			map[int]string{100: "Gross profit", 500: "247", 700: "454"},
+		),
+		want: [][]string{
+			{"Item", "2022", "2023"},
+			{"Revenue from sales", "1,234", "1,456"},
+			{"Cost of goods sold", "987", "1,002"},
+			{"Gross profit", "247", "454"},
+		},
+	}, {
+		name: "narrow grid",
+		page: rowsPage(
+			map[int]string{100: "Name", 400: "Role"},
+			map[int]string{100: "Ann", 400: "Editor"},
+			map[int]string{100: "Budi", 400: "Writer"},
+		),
+		want: [][]string{
+			{"Name", "Role"},
+			{"Ann", "Editor"},
+			{"Budi", "Writer"},
+		},
+	}, {
+		name: "wide grid of text",
+		page: rowsPage(
+			map[int]string{100: "the first long phrase", 370: "another long phrase", 610: "and the third phrase"},
+			map[int]string{100: "more words in here", 370: "that fill the cell", 610: "with plain text only"},
+			map[int]string{100: "and the last line", 370: "which is not a table", 610: "since it is all text"},
+		),
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tables := Detect(tt.page)
+			if tt.want == nil {
+				if len(tables) > 0 {
+					t.Errorf("got %d table(s), want none", len(tables))
+				}
+				return
+			}
+
+			if len(tables) != 1 {
+				t.Fatalf("got %d table(s), want one", len(tables))
+			}
+
+			assertCells(t, tables[0], tt.want)
+		})
+	}
+}
+
+func TestDetectRegion(t *testing.T) {
+	// Table marked by Vision only needs two rows
+	page := rowsPage(
+		map[int]string{100: "Name", 400: "Role"},
+		map[int]string{100: "Ann", 400: "Editor"},
+	)
+	page.Regions = []vision.Region{{
+		Type:        vision.RegionTable,
+		BoundingBox: image.Rect(90, 90, 500, 150),
+	}}
+
+	tables := Detect(page)
+	if len(tables) != 1 {
+		t.Fatalf("got %d table(s), want one", len(tables))
+	}
+
+	assertCells(t, tables[0], [][]string{{"Name", "Role"}, {"Ann", "Editor"}})
+}
+
+func assertCells(t *testing.T, table Table, want [][]string) {
+	t.Helper()
+	if len(table.Rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(table.Rows), len(want))
+	}
+
+	for i, row := range table.Rows {
+		var got []string
+		for _, c := range row {
+			got = append(got, c.Text())
+		}
+
+		if strings.Join(got, "|") != strings.Join(want[i], "|") {
+			t.Errorf("row %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
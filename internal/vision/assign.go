@@ -0,0 +1,124 @@
+package vision
+
+import (
+	"image"
+)
+
+// assignParagraphs puts each paragraph to the tile it overlaps most. If a
+// paragraph straddles several tiles, its lines will be split between those
+// tiles, and straddling line will have its words split as well. Words that
+// don't overlap any tile are returned as unassigned.
+func assignParagraphs(paragraphs []Paragraph, tiles []image.Rectangle) ([][]Paragraph, []Word) {
+	tileParagraphs := make([][]Paragraph, len(tiles))
+	var unassigned []Word
+
+	for _, p := range paragraphs {
+		// If paragraph is fully inside a tile, use it as it is
+		idx, full := bestTile(p.BoundingBox, tiles)
+		if full {
+			tileParagraphs[idx] = append(tileParagraphs[idx], p)
+			continue
+		}
+
+		// Split lines of paragraph to each tile
+		parts := make([]*Paragraph, len(tiles))
+		addLine := func(idx int, l Line) {
+			if parts[idx] == nil {
+				parts[idx] = &Paragraph{
+					Confidence:  p.Confidence,
+					Language:    p.Language,
+					BoundingBox: l.BoundingBox,
+				}
+			}
+
+			parts[idx].Lines = append(parts[idx].Lines, l)
+			parts[idx].BoundingBox = parts[idx].BoundingBox.Union(l.BoundingBox)
+		}
+
+		for _, l := range p.Lines {
+			// If line is fully inside a tile, use it as it is
+			lineIdx, lineFull := bestTile(l.BoundingBox, tiles)
+			if lineFull {
+				addLine(lineIdx, l)
+				continue
+			}
+
+			// Split words of line to each tile
+			lineParts := make([]*Line, len(tiles))
+			for _, w := range l.Words {
+				wordIdx, _ := bestTile(w.BoundingBox, tiles)
+				if wordIdx < 0 {
+					unassigned = append(unassigned, w)
+					continue
+				}
+
+				if lineParts[wordIdx] == nil {
+					lineParts[wordIdx] = &Line{BoundingBox: w.BoundingBox}
+				}
+
+				lp := lineParts[wordIdx]
+				lp.Words = append(lp.Words, w)
+				lp.BoundingBox = lp.BoundingBox.Union(w.BoundingBox)
+			}
+
+			for i, lp := range lineParts {
+				if lp != nil {
+					addLine(i, *lp)
+				}
+			}
+		}
+
+		for i, part := range parts {
+			if part != nil {
+				tileParagraphs[i] = append(tileParagraphs[i], *part)
+			}
+		}
+	}
+
+	return tileParagraphs, unassigned
+}
+
+// assignRegions splits regions to each tile, clipped by the tile bounds.
+// Region that doesn't overlap any tile is dropped.
+func assignRegions(regions []Region, tiles []image.Rectangle) [][]Region {
+	tileRegions := make([][]Region, len(tiles))
+	for _, r := range regions {
+		idx, _ := bestTile(r.BoundingBox, tiles)
+		if idx < 0 {
+			continue
+		}
+
+		r.BoundingBox = r.BoundingBox.Intersect(tiles[idx])
+		tileRegions[idx] = append(tileRegions[idx], r)
+	}
+	return tileRegions
+}
+
+// bestTile returns index of tile that overlaps the rect most, or -1 if the
+// rect doesn't overlap any tile. It also reports whether the rect is fully
+// inside that tile.
+func bestTile(rect image.Rectangle, tiles []image.Rectangle) (int, bool) {
+	// Empty rect doesn't have area, so use its position instead
+	if rect.Empty() {
+		for i, tile := range tiles {
+			if rect.Min.In(tile) {
+				return i, true
+			}
+		}
+		return -1, false
+	}
+
+	bestIdx, bestArea := -1, 0
+	for i, tile := range tiles {
+		overlap := rect.Intersect(tile)
+		if area := overlap.Dx() * overlap.Dy(); area > bestArea {
+			bestIdx, bestArea = i, area
+		}
+	}
+
+	if bestIdx < 0 {
+		return -1, false
+	}
+
+	return bestIdx, rect.In(tiles[bestIdx])
+}
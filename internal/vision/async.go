@@ -0,0 +1,276 @@
+package vision
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"path"
+	"strings"
+	"time"
+
+	vision "cloud.google.com/go/vision/apiv1"
+	visionpb "cloud.google.com/go/vision/v2/apiv1/visionpb"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/montage"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/storage"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// MaxFilePages is the max number of pages in a file for async OCR.
+const MaxFilePages = 2000
+
+// AsyncOptions specifies how the async OCR is done.
+type AsyncOptions struct {
+	// Storage is where the input file uploaded and output written by Vision.
+	Storage storage.Storage
+
+	// Name is the directory in storage for this job. It must be unique,
+	// otherwise output of the other jobs will be mixed in.
+	Name string
+
+	// PagesPerShard is the number of pages in each output JSON.
+	PagesPerShard int
+
+	// PollInterval is the delay between checking the operation status.
+	PollInterval time.Duration
+
+	// Annotator starts the async OCR. If it's nil, Vision API client is
+	// opened for the job.
+	Annotator FileAnnotator
+}
+
+// FileAnnotator starts async OCR for files in storage. It's implemented by
+// Vision API client, and can be replaced by fake for testing.
+type FileAnnotator interface {
+	AsyncBatchAnnotateFiles(ctx context.Context, req *visionpb.AsyncBatchAnnotateFilesRequest) (FileOperation, error)
+}
+
+// FileOperation is a running async OCR.
+type FileOperation interface {
+	Name() string
+
+	// Poll checks the operation once, then returns its current state and
+	// whether it's already done.
+	Poll(ctx context.Context) (state string, done bool, err error)
+}
+
+// ParseFile runs async OCR for the montages, which already encoded as a PDF
+// with one montage per page. The returned error is only for the whole job,
+// while error for each montage is put in its result.
+func ParseFile(ctx context.Context, montages []montage.Montage, data []byte, opts AsyncOptions) ([]BatchResult, error) {
+	// Make sure the options are valid
+	if opts.Storage == nil {
+		return nil, fmt.Errorf("storage for async ocr is not specified")
+	}
+
+	if len(montages) > MaxFilePages {
+		return nil, fmt.Errorf("file has %d pages, max is %d", len(montages), MaxFilePages)
+	}
+
+	if opts.PagesPerShard < 1 || opts.PagesPerShard > 100 {
+		opts.PagesPerShard = 20
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 10 * time.Second
+	}
+
+	log := logrus.WithField("job", opts.Name)
+
+	// Open vision client API
+	annotator := opts.Annotator
+	if annotator == nil {
+		client, err := vision.NewImageAnnotatorClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+
+		annotator = clientAnnotator{client}
+	}
+
+	// Upload the input file
+	inputName := path.Join(opts.Name, "input.pdf")
+	outputPrefix := path.Join(opts.Name, "output") + "/"
+	if err := opts.Storage.Put(ctx, inputName, data); err != nil {
+		return nil, fmt.Errorf("upload input failed: %w", err)
+	}
+	defer removeObjects(opts.Storage, log, inputName)
+
+	// Start the operation
+	op, err := annotator.AsyncBatchAnnotateFiles(ctx, &visionpb.AsyncBatchAnnotateFilesRequest{
+		Requests: []*visionpb.AsyncAnnotateFileRequest{{
+			InputConfig: &visionpb.InputConfig{
+				GcsSource: &visionpb.GcsSource{Uri: opts.Storage.URI(inputName)},
+				MimeType:  "application/pdf",
+			},
+			Features: []*visionpb.Feature{{
+				Type: visionpb.Feature_DOCUMENT_TEXT_DETECTION,
+			}},
+			OutputConfig: &visionpb.OutputConfig{
+				GcsDestination: &visionpb.GcsDestination{Uri: opts.Storage.URI(outputPrefix)},
+				BatchSize:      int32(opts.PagesPerShard),
+			},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Poll until the operation finished
+	log = log.WithField("operation", op.Name())
+	log.Debug("async ocr started")
+
+	for {
+		state, done, err := op.Poll(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if done {
+			break
+		}
+
+		if state != "" {
+			log.WithField("state", state).Debug("async ocr running")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(opts.PollInterval):
+		}
+	}
+
+	// Download the output shards
+	shardNames, err := opts.Storage.List(ctx, outputPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("list output failed: %w", err)
+	}
+	defer removeObjects(opts.Storage, log, shardNames...)
+
+	responses := make([]*visionpb.AnnotateImageResponse, len(montages))
+	for _, name := range shardNames {
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		shard, err := opts.Storage.Get(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("download output failed: %w", err)
+		}
+
+		var fileResponse visionpb.AnnotateFileResponse
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(shard, &fileResponse)
+		if err != nil {
+			return nil, fmt.Errorf("parse output \"%s\" failed: %w", path.Base(name), err)
+		}
+
+		// Put each response by its page number, which starts from 1
+		for _, res := range fileResponse.Responses {
+			pageNumber := int(res.GetContext().GetPageNumber())
+			if pageNumber >= 1 && pageNumber <= len(montages) {
+				responses[pageNumber-1] = res
+			}
+		}
+	}
+
+	// Convert each response into pages
+	results := make([]BatchResult, len(montages))
+	for i, res := range responses {
+		switch {
+		case res == nil:
+			results[i].Err = fmt.Errorf("no output for page %d", i+1)
+		case res.Error != nil:
+			results[i].Err = status.Errorf(codes.Code(res.Error.Code), "%s", res.Error.Message)
+		case res.FullTextAnnotation != nil:
+			annotation := res.FullTextAnnotation
+			denormalizeAnnotation(annotation, montages[i].Image.Bounds().Size())
+			results[i].Pages = parseAnnotation(montages[i], annotation)
+		}
+	}
+
+	return results, nil
+}
+
+// clientAnnotator is FileAnnotator that uses Vision API client.
+type clientAnnotator struct {
+	client *vision.ImageAnnotatorClient
+}
+
+func (c clientAnnotator) AsyncBatchAnnotateFiles(ctx context.Context, req *visionpb.AsyncBatchAnnotateFilesRequest) (FileOperation, error) {
+	op, err := c.client.AsyncBatchAnnotateFiles(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return clientOperation{op}, nil
+}
+
+type clientOperation struct {
+	op *vision.AsyncBatchAnnotateFilesOperation
+}
+
+func (c clientOperation) Name() string {
+	return c.op.Name()
+}
+
+func (c clientOperation) Poll(ctx context.Context) (string, bool, error) {
+	if _, err := c.op.Poll(ctx); err != nil {
+		return "", false, err
+	}
+
+	var state string
+	if meta, err := c.op.Metadata(); err == nil && meta != nil {
+		state = meta.State.String()
+	}
+
+	return state, c.op.Done(), nil
+}
+
+// denormalizeAnnotation converts the normalized vertices, which is used for
+// PDF input, into pixel vertices of the image with specified size.
+func denormalizeAnnotation(annotation *visionpb.TextAnnotation, size image.Point) {
+	denormalize := func(bp *visionpb.BoundingPoly) {
+		if bp == nil || len(bp.Vertices) > 0 {
+			return
+		}
+
+		for _, v := range bp.NormalizedVertices {
+			bp.Vertices = append(bp.Vertices, &visionpb.Vertex{
+				X: int32(math.Round(float64(v.X) * float64(size.X))),
+				Y: int32(math.Round(float64(v.Y) * float64(size.Y))),
+			})
+		}
+	}
+
+	for _, page := range annotation.Pages {
+		for _, block := range page.Blocks {
+			denormalize(block.BoundingBox)
+			for _, paragraph := range block.Paragraphs {
+				denormalize(paragraph.BoundingBox)
+				for _, word := range paragraph.Words {
+					denormalize(word.BoundingBox)
+					for _, symbol := range word.Symbols {
+						denormalize(symbol.BoundingBox)
+					}
+				}
+			}
+		}
+	}
+}
+
+// removeObjects cleans up the job files from storage. It uses its own context
+// since it might be called after the job context is cancelled.
+func removeObjects(st storage.Storage, log *logrus.Entry, names ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, name := range names {
+		if err := st.Delete(ctx, name); err != nil {
+			log.WithError(err).WithField("object", name).Warn("remove async ocr file failed")
+		}
+	}
+}
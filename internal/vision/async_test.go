@@ -0,0 +1,187 @@
+package vision
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	visionpb "cloud.google.com/go/vision/v2/apiv1/visionpb"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/montage"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/storage"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// fakeAnnotator works like Vision async OCR on local storage. It checks the
+// input file, then writes the responses as output shards.
+type fakeAnnotator struct {
+	responses []*visionpb.AnnotateImageResponse
+	shardSize int
+	polls     int
+}
+
+func (f *fakeAnnotator) AsyncBatchAnnotateFiles(ctx context.Context, req *visionpb.AsyncBatchAnnotateFilesRequest) (FileOperation, error) {
+	fileReq := req.Requests[0]
+	inputPath := strings.TrimPrefix(fileReq.InputConfig.GcsSource.Uri, "file://")
+	if _, err := os.Stat(inputPath); err != nil {
+		return nil, fmt.Errorf("input not uploaded: %w", err)
+	}
+
+	outputDir := strings.TrimPrefix(fileReq.OutputConfig.GcsDestination.Uri, "file://")
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(f.responses); start += f.shardSize {
+		end := min(start+f.shardSize, len(f.responses))
+		data, err := protojson.Marshal(&visionpb.AnnotateFileResponse{
+			Responses: f.responses[start:end],
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		shardName := fmt.Sprintf("%s/output-%d-to-%d.json", outputDir, start+1, end)
+		if err = os.WriteFile(shardName, data, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return &fakeOperation{annotator: f}, nil
+}
+
+type fakeOperation struct {
+	annotator *fakeAnnotator
+}
+
+func (o *fakeOperation) Name() string {
+	return "fake-operation"
+}
+
+func (o *fakeOperation) Poll(ctx context.Context) (string, bool, error) {
+	o.annotator.polls++
+	return "RUNNING", o.annotator.polls > 1, nil
+}
+
+func textResponse(pageNumber int32, text string) *visionpb.AnnotateImageResponse {
+	box := &visionpb.BoundingPoly{NormalizedVertices: []*visionpb.NormalizedVertex{
+		{X: 0.1, Y: 0.2}, {X: 0.5, Y: 0.2}, {X: 0.5, Y: 0.6}, {X: 0.1, Y: 0.6},
+	}}
+
+	var symbols []*visionpb.Symbol
+	for _, r := range text {
+		symbols = append(symbols, &visionpb.Symbol{Text: string(r), BoundingBox: box})
+	}
+
+	return &visionpb.AnnotateImageResponse{
+		Context: &visionpb.ImageAnnotationContext{PageNumber: pageNumber},
+		FullTextAnnotation: &visionpb.TextAnnotation{
+			Pages: []*visionpb.Page{{
+				Blocks: []*visionpb.Block{{
+					BoundingBox: box,
+					Paragraphs: []*visionpb.Paragraph{{
+						BoundingBox: box,
+						Words: []*visionpb.Word{{
+							BoundingBox: box,
+							Symbols:     symbols,
+						}},
+					}},
+				}},
+			}},
+		},
+	}
+}
+
+func errorResponse(t *testing.T, pageNumber int32, message string) *visionpb.AnnotateImageResponse {
+	var res visionpb.AnnotateImageResponse
+	data := fmt.Sprintf(`{"context":{"pageNumber":%d},"error":{"code":3,"message":%q}}`, pageNumber, message)
+	if err := protojson.Unmarshal([]byte(data), &res); err != nil {
+		t.Fatal(err)
+	}
+	return &res
+}
+
+func TestParseFile(t *testing.T) {
+	st, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Three montages with one page each. The second page fails, and the
+	// third page is in the second shard.
+	var montages []montage.Montage
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		montages = append(montages, montage.Montage{
+			Image:  image.NewGray(image.Rect(0, 0, 200, 100)),
+			Paths:  []string{name},
+			Bounds: []image.Rectangle{image.Rect(0, 0, 200, 100)},
+		})
+	}
+
+	annotator := &fakeAnnotator{
+		shardSize: 2,
+		responses: []*visionpb.AnnotateImageResponse{
+			textResponse(1, "hello"),
+			errorResponse(t, 2, "bad image"),
+			textResponse(3, "world"),
+		},
+	}
+
+	results, err := ParseFile(context.Background(), montages, []byte("%PDF-1.4"), AsyncOptions{
+		Storage:       st,
+		Name:          "job",
+		PagesPerShard: 2,
+		PollInterval:  time.Millisecond,
+		Annotator:     annotator,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	for i, want := range []string{"hello", "", "world"} {
+		res := results[i]
+		if want == "" {
+			if res.Err == nil {
+				t.Errorf("result %d: want error", i)
+			}
+			continue
+		}
+
+		if res.Err != nil {
+			t.Errorf("result %d: %v", i, res.Err)
+			continue
+		}
+
+		if len(res.Pages) != 1 || len(res.Pages[0].Paragraphs) != 1 {
+			t.Errorf("result %d: want one page with one paragraph, got %+v", i, res.Pages)
+			continue
+		}
+
+		p := res.Pages[0].Paragraphs[0]
+		if got := p.Text(); got != want {
+			t.Errorf("result %d: got text %q, want %q", i, got, want)
+		}
+
+		// Normalized vertices are converted into pixels of the montage
+		if wantRect := image.Rect(20, 20, 100, 60); p.BoundingBox != wantRect {
+			t.Errorf("result %d: got bounds %v, want %v", i, p.BoundingBox, wantRect)
+		}
+	}
+
+	// Input and output files are removed after the job
+	names, err := st.List(context.Background(), "job/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) > 0 {
+		t.Errorf("job files are not removed: %v", names)
+	}
+}
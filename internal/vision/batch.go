@@ -0,0 +1,95 @@
+package vision
+
+import (
+	"context"
+	"fmt"
+
+	vision "cloud.google.com/go/vision/apiv1"
+	visionpb "cloud.google.com/go/vision/v2/apiv1/visionpb"
+	"github.com/RadhiFadlillah/vision-my-pdf/internal/montage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxBatchSize is the max number of images in a single batch request.
+const MaxBatchSize = 16
+
+// BatchResult is the OCR result for a montage inside batch request.
+type BatchResult struct {
+	Pages []Page
+	Err   error
+}
+
+// ParseBatch runs OCR for several montages in a single request, which data
+// are the montage images that already encoded for upload. The returned error
+// is only for the whole request, while error for each montage is put in its
+// result.
+func ParseBatch(ctx context.Context, montages []montage.Montage, data [][]byte) ([]BatchResult, error) {
+	// Make sure the batch is valid
+	if len(montages) != len(data) {
+		return nil, fmt.Errorf("batch has %d montages but %d images", len(montages), len(data))
+	}
+
+	if len(montages) > MaxBatchSize {
+		return nil, fmt.Errorf("batch has %d images, max is %d", len(montages), MaxBatchSize)
+	}
+
+	// Open vision client API
+	client, err := vision.NewImageAnnotatorClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	// Prepare request for each montage. Empty image is skipped.
+	results := make([]BatchResult, len(montages))
+	requestIndexes := make([]int, 0, len(montages))
+	var requests []*visionpb.AnnotateImageRequest
+
+	for i, m := range montages {
+		bounds := m.Image.Bounds().Size()
+		if valid := bounds.X > 1 && bounds.Y > 1; !valid {
+			continue
+		}
+
+		requestIndexes = append(requestIndexes, i)
+		requests = append(requests, &visionpb.AnnotateImageRequest{
+			Image: &visionpb.Image{Content: data[i]},
+			Features: []*visionpb.Feature{{
+				Type: visionpb.Feature_DOCUMENT_TEXT_DETECTION,
+			}},
+		})
+	}
+
+	if len(requests) == 0 {
+		return results, nil
+	}
+
+	// Send the request
+	response, err := client.BatchAnnotateImages(ctx, &visionpb.BatchAnnotateImagesRequest{
+		Requests: requests,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response.Responses) != len(requests) {
+		return nil, fmt.Errorf("batch returns %d responses for %d images",
+			len(response.Responses), len(requests))
+	}
+
+	// Map each response back to its montage
+	for i, res := range response.Responses {
+		idx := requestIndexes[i]
+		if res.Error != nil {
+			results[idx].Err = status.Errorf(codes.Code(res.Error.Code), "%s", res.Error.Message)
+			continue
+		}
+
+		if res.FullTextAnnotation != nil {
+			results[idx].Pages = parseAnnotation(montages[idx], res.FullTextAnnotation)
+		}
+	}
+
+	return results, nil
+}
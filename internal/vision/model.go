@@ -2,12 +2,16 @@ package vision
 
 import (
 	"image"
+	"strings"
 )
 
 type Page struct {
 	Image       string
 	Paragraphs  []Paragraph
+	Regions     []Region `json:",omitempty"`
 	BoundingBox image.Rectangle
+	Inverted    bool   `json:",omitempty"`
+	Direction   string `json:",omitempty"`
 }
 
 func (p Page) Offset(pt image.Point) Page {
@@ -15,14 +19,73 @@ func (p Page) Offset(pt image.Point) Page {
 	for i, pa := range p.Paragraphs {
 		p.Paragraphs[i] = pa.Offset(pt)
 	}
+	for i, r := range p.Regions {
+		p.Regions[i].BoundingBox = r.BoundingBox.Add(pt)
+	}
 	return p
 }
 
+func (p Page) Map(fn func(image.Rectangle) image.Rectangle) Page {
+	p.BoundingBox = fn(p.BoundingBox)
+	for i, pa := range p.Paragraphs {
+		p.Paragraphs[i] = pa.Map(fn)
+	}
+	for i, r := range p.Regions {
+		p.Regions[i].BoundingBox = fn(r.BoundingBox)
+	}
+	return p
+}
+
+// Types of region in page, which marked by Vision as non text block.
+const (
+	RegionTable   = "table"
+	RegionPicture = "picture"
+)
+
+// Region is an area in page that detected by Vision as table or picture.
+type Region struct {
+	Type        string
+	BoundingBox image.Rectangle
+}
+
+// Roles of paragraph. Header, footer, page number and the notes are not part
+// of the main text, while the rest are the structure of main text.
+const (
+	RoleHeader     = "header"
+	RoleFooter     = "footer"
+	RolePageNumber = "page-number"
+	RoleFootnote   = "footnote"
+	RoleMarginal   = "marginal"
+	RoleCaption    = "caption"
+	RoleHeading    = "heading"
+	RoleListItem   = "list-item"
+	RoleQuote      = "quote"
+)
+
+// Emphasis of word, which inferred from the page image since Vision doesn't
+// report the font style.
+const (
+	EmphasisStrong = "strong"
+)
+
 type Paragraph struct {
-	Lines       []Line `json:",omitempty"`
+	Lines       []Line  `json:",omitempty"`
+	Confidence  float32 `json:",omitempty"`
+	Language    string  `json:",omitempty"`
+	Direction   string  `json:",omitempty"`
+	Role        string  `json:",omitempty"`
+	Level       int     `json:",omitempty"`
 	BoundingBox image.Rectangle
 }
 
+func (pa Paragraph) Text() string {
+	var lines []string
+	for _, l := range pa.Lines {
+		lines = append(lines, l.Text())
+	}
+	return strings.Join(lines, " ")
+}
+
 func (pa Paragraph) Offset(pt image.Point) Paragraph {
 	pa.BoundingBox = pa.BoundingBox.Add(pt)
 	for i, l := range pa.Lines {
@@ -31,11 +94,27 @@ func (pa Paragraph) Offset(pt image.Point) Paragraph {
 	return pa
 }
 
+func (pa Paragraph) Map(fn func(image.Rectangle) image.Rectangle) Paragraph {
+	pa.BoundingBox = fn(pa.BoundingBox)
+	for i, l := range pa.Lines {
+		pa.Lines[i] = l.Map(fn)
+	}
+	return pa
+}
+
 type Line struct {
 	Words       []Word `json:",omitempty"`
 	BoundingBox image.Rectangle
 }
 
+func (l Line) Text() string {
+	var words []string
+	for _, w := range l.Words {
+		words = append(words, w.Text())
+	}
+	return strings.Join(words, " ")
+}
+
 func (l Line) Offset(pt image.Point) Line {
 	l.BoundingBox = l.BoundingBox.Add(pt)
 	for i, w := range l.Words {
@@ -44,13 +123,31 @@ func (l Line) Offset(pt image.Point) Line {
 	return l
 }
 
+func (l Line) Map(fn func(image.Rectangle) image.Rectangle) Line {
+	l.BoundingBox = fn(l.BoundingBox)
+	for i, w := range l.Words {
+		l.Words[i] = w.Map(fn)
+	}
+	return l
+}
+
 type Word struct {
 	Symbols     []Symbol `json:",omitempty"`
 	Prefix      string   `json:",omitempty"`
 	Suffix      string   `json:",omitempty"`
+	Confidence  float32  `json:",omitempty"`
+	Emphasis    string   `json:",omitempty"`
 	BoundingBox image.Rectangle
 }
 
+func (w Word) Text() string {
+	var sb strings.Builder
+	for _, s := range w.Symbols {
+		sb.WriteString(s.Text)
+	}
+	return sb.String()
+}
+
 func (w Word) Offset(pt image.Point) Word {
 	w.BoundingBox = w.BoundingBox.Add(pt)
 	for i, s := range w.Symbols {
@@ -59,6 +156,14 @@ func (w Word) Offset(pt image.Point) Word {
 	return w
 }
 
+func (w Word) Map(fn func(image.Rectangle) image.Rectangle) Word {
+	w.BoundingBox = fn(w.BoundingBox)
+	for i, s := range w.Symbols {
+		w.Symbols[i] = s.Map(fn)
+	}
+	return w
+}
+
 type Symbol struct {
 	Text        string `json:",omitempty"`
 	Prefix      string `json:",omitempty"`
@@ -70,3 +175,8 @@ func (s Symbol) Offset(pt image.Point) Symbol {
 	s.BoundingBox = s.BoundingBox.Add(pt)
 	return s
 }
+
+func (s Symbol) Map(fn func(image.Rectangle) image.Rectangle) Symbol {
+	s.BoundingBox = fn(s.BoundingBox)
+	return s
+}
@@ -3,16 +3,18 @@ package vision
 import (
 	"bytes"
 	"context"
-	"image"
-	"image/png"
+	"path/filepath"
 	"strings"
 
 	vision "cloud.google.com/go/vision/apiv1"
 	visionpb "cloud.google.com/go/vision/v2/apiv1/visionpb"
 	"github.com/RadhiFadlillah/vision-my-pdf/internal/montage"
+	"github.com/sirupsen/logrus"
 )
 
-func ParseMontage(ctx context.Context, montage montage.Montage) ([]Page, error) {
+// ParseMontage runs OCR for the montage. The data is the montage image that
+// already encoded for upload.
+func ParseMontage(ctx context.Context, montage montage.Montage, data []byte) ([]Page, error) {
 	// Open vision client API
 	client, err := vision.NewImageAnnotatorClient(ctx)
 	if err != nil {
@@ -25,15 +27,8 @@ func ParseMontage(ctx context.Context, montage montage.Montage) ([]Page, error)
 		return nil, nil
 	}
 
-	// Encode to the new reader
-	var buf bytes.Buffer
-	err = png.Encode(&buf, montage.Image)
-	if err != nil {
-		return nil, err
-	}
-
 	// Decode visionImg for Google vision
-	r := bytes.NewReader(buf.Bytes())
+	r := bytes.NewReader(data)
 	visionImg, err := vision.NewImageFromReader(r)
 	if err != nil {
 		return nil, err
@@ -49,10 +44,24 @@ func ParseMontage(ctx context.Context, montage montage.Montage) ([]Page, error)
 		return nil, nil
 	}
 
-	// Extract each paragraphs from OCR result
+	return parseAnnotation(montage, annotations), nil
+}
+
+// parseAnnotation extracts the paragraphs from OCR result, then split them to
+// each page in montage.
+func parseAnnotation(montage montage.Montage, annotations *visionpb.TextAnnotation) []Page {
+	// Extract each paragraphs and non text regions from OCR result
 	var montageParagraphs []Paragraph
+	var montageRegions []Region
 	for _, visionPage := range annotations.Pages {
 		for _, visionBlock := range visionPage.Blocks {
+			switch visionBlock.BlockType {
+			case visionpb.Block_TABLE:
+				montageRegions = append(montageRegions, Region{RegionTable, bpToRect(visionBlock.BoundingBox)})
+			case visionpb.Block_PICTURE:
+				montageRegions = append(montageRegions, Region{RegionPicture, bpToRect(visionBlock.BoundingBox)})
+			}
+
 			for _, visionParagraph := range visionBlock.Paragraphs {
 				p := parseParagraph(visionParagraph)
 				montageParagraphs = append(montageParagraphs, p)
@@ -61,36 +70,49 @@ func ParseMontage(ctx context.Context, montage montage.Montage) ([]Page, error)
 	}
 
 	// Split paragraphs to each page
-	var pages []Page
-	var montageParagraphCursor int
+	pageParagraphs, unassigned := assignParagraphs(montageParagraphs, montage.Bounds)
+	if len(unassigned) > 0 {
+		var texts []string
+		for _, w := range unassigned {
+			texts = append(texts, w.Text())
+		}
 
-	for i, imgPath := range montage.Paths {
-		// Save paragraphs for current page
-		var paragraphs []Paragraph
-		for montageParagraphCursor < len(montageParagraphs) {
-			paragraph := montageParagraphs[montageParagraphCursor]
-			if !paragraph.BoundingBox.In(montage.Bounds[i]) {
-				break
-			}
+		logrus.WithFields(logrus.Fields{
+			"montage": strings.TrimSuffix(montage.Name(), filepath.Ext(montage.Name())),
+			"words":   texts,
+		}).Warnf("%d word(s) can't be assigned to any page", len(unassigned))
+	}
 
-			paragraphs = append(paragraphs, paragraph)
-			montageParagraphCursor++
-		}
+	pageRegions := assignRegions(montageRegions, montage.Bounds)
 
-		// Save the page
-		pages = append(pages, Page{
+	var pages []Page
+	for i, imgPath := range montage.Paths {
+		page := Page{
 			Image:       imgPath,
 			BoundingBox: montage.Bounds[i],
-			Paragraphs:  paragraphs,
-		}.Offset(image.Pt(0, -montage.Bounds[i].Min.Y)))
+			Paragraphs:  pageParagraphs[i],
+			Regions:     pageRegions[i],
+			Inverted:    i < len(montage.Inverted) && montage.Inverted[i],
+		}.Offset(montage.Bounds[i].Min.Mul(-1))
+
+		// If the image was modified before put in montage, map the
+		// coordinates back to the source image.
+		if i < len(montage.Transforms) && !montage.Transforms[i].IsIdentity() {
+			page = page.Map(montage.Transforms[i].Rect)
+			page.BoundingBox = montage.SourceBounds[i]
+		}
+
+		pages = append(pages, page)
 	}
 
-	return pages, nil
+	return pages
 }
 
 func parseParagraph(paragraph *visionpb.Paragraph) Paragraph {
 	// Prepare result
 	result := Paragraph{
+		Confidence:  paragraph.Confidence,
+		Language:    detectedLanguage(paragraph.Property),
 		BoundingBox: bpToRect(paragraph.BoundingBox),
 	}
 
@@ -108,6 +130,9 @@ func parseParagraph(paragraph *visionpb.Paragraph) Paragraph {
 		if nWord := len(words); nWord > 0 {
 			lastWord := words[nWord-1]
 			if lastWord.Suffix == "" && parsedWord.Prefix == "" {
+				nLast, nParsed := len(lastWord.Symbols), len(parsedWord.Symbols)
+				lastWord.Confidence = (lastWord.Confidence*float32(nLast) +
+					parsedWord.Confidence*float32(nParsed)) / float32(nLast+nParsed)
 				lastWord.Symbols = append(lastWord.Symbols, parsedWord.Symbols...)
 				lastWord.BoundingBox = lastWord.BoundingBox.Union(parsedWord.BoundingBox)
 				lastWord.Suffix = parsedWord.Suffix
@@ -170,6 +195,7 @@ func parseParagraph(paragraph *visionpb.Paragraph) Paragraph {
 func parseWord(word *visionpb.Word) Word {
 	// Prepare result
 	result := Word{
+		Confidence:  word.Confidence,
 		BoundingBox: bpToRect(word.BoundingBox),
 	}
 
@@ -15,3 +15,15 @@ func bpToRect(bp *visionpb.BoundingPoly) image.Rectangle {
 	min, max := vertices[0], vertices[2]
 	return image.Rect(int(min.X), int(min.Y), int(max.X), int(max.Y))
 }
+
+// detectedLanguage returns the language with highest confidence.
+func detectedLanguage(property *visionpb.TextAnnotation_TextProperty) string {
+	var language string
+	var confidence float32 = -1
+	for _, dl := range property.GetDetectedLanguages() {
+		if dl.Confidence > confidence {
+			language, confidence = dl.LanguageCode, dl.Confidence
+		}
+	}
+	return language
+}